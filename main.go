@@ -2,18 +2,36 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/pelletier/go-toml/v2"
 	"github.com/urfave/cli/v2"
+	"github.com/xrash/smetrics"
+	"go/parser"
+	"go/token"
+	"hash"
+	"io"
 	"log"
+	"maps"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 // SystemUtils contains utilities to interact with the system
@@ -39,6 +57,9 @@ type FsI interface {
 	Exists(path string) bool
 	Read(path string) ([]byte, error)
 	Write(path string, content []byte) error
+	MkdirAll(path string) error
+	RemoveAll(path string) error
+	Rename(oldPath, newPath string) error
 	Walk(root string, walkFn filepath.WalkFunc) error
 }
 
@@ -63,48 +84,544 @@ func (fs *Fs) Write(path string, content []byte) (err error) {
 	return os.WriteFile(path, content, 0644)
 }
 
+// MkdirAll creates a directory and its parents if they do not exist
+func (fs *Fs) MkdirAll(path string) (err error) {
+	return os.MkdirAll(path, 0755)
+}
+
+// RemoveAll removes a file or a directory and its content
+func (fs *Fs) RemoveAll(path string) (err error) {
+	return os.RemoveAll(path)
+}
+
+// Rename moves a file or a directory
+func (fs *Fs) Rename(oldPath, newPath string) (err error) {
+	return os.Rename(oldPath, newPath)
+}
+
 // Walk walks the filesystem
 func (fs *Fs) Walk(root string, walkFn filepath.WalkFunc) (err error) {
 	return filepath.Walk(root, walkFn)
 }
 
+// DryRunFs implements FsI, it reads from the wrapped filesystem but only logs the changes
+// Files written during the run are kept in memory so that the next reads see them, and paths
+// in a renamed folder are read from where the folder still is
+type DryRunFs struct {
+	Fs      FsI
+	Logger  LlogI
+	mu      sync.Mutex
+	written map[string][]byte
+	removed []string
+	renamed [][2]string // old and new path of the renames, in order
+}
+
+var _ FsI = &DryRunFs{}
+
+// NewDryRunFs returns an instance of DryRunFs
+func NewDryRunFs(fs FsI, logger LlogI) *DryRunFs {
+	return &DryRunFs{
+		Fs:      fs,
+		Logger:  logger,
+		written: map[string][]byte{},
+	}
+}
+
+// Exists checks if a file exists, or would exist
+func (fs *DryRunFs) Exists(path string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.written[path]; ok {
+		return true
+	}
+	return !fs.isRemoved(path) && fs.Fs.Exists(fs.source(path))
+}
+
+// Read reads and return a file, or the content it would have
+func (fs *DryRunFs) Read(path string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if content, ok := fs.written[path]; ok {
+		return content, nil
+	}
+	if fs.isRemoved(path) {
+		return nil, os.ErrNotExist
+	}
+	return fs.Fs.Read(fs.source(path))
+}
+
+// Write logs the file that would be written
+func (fs *DryRunFs) Write(path string, content []byte) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.written[path] = content
+	fs.Logger.InfoLn("dry run: would write " + path)
+	return nil
+}
+
+// MkdirAll logs the directory that would be created
+func (fs *DryRunFs) MkdirAll(path string) (err error) {
+	if !fs.Exists(path) {
+		fs.Logger.InfoLn("dry run: would create directory " + path)
+	}
+	return nil
+}
+
+// RemoveAll logs the file or directory that would be removed
+func (fs *DryRunFs) RemoveAll(path string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.removed = append(fs.removed, path)
+	fs.Logger.InfoLn("dry run: would remove " + path)
+	return nil
+}
+
+// Rename logs the file or directory that would be moved
+func (fs *DryRunFs) Rename(oldPath, newPath string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for path, content := range fs.written {
+		if moved, ok := movePath(path, oldPath, newPath); ok {
+			delete(fs.written, path)
+			fs.written[moved] = content
+		}
+	}
+	fs.removed = append(fs.removed, oldPath)
+	fs.renamed = append(fs.renamed, [2]string{oldPath, newPath})
+	fs.Logger.InfoLn("dry run: would move " + oldPath + " to " + newPath)
+	return nil
+}
+
+// Walk walks the wrapped filesystem, from where a renamed folder still is, without the removed paths
+func (fs *DryRunFs) Walk(root string, walkFn filepath.WalkFunc) (err error) {
+	fs.mu.Lock()
+	source := fs.source(root)
+	fs.mu.Unlock()
+	return fs.Fs.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if moved, ok := movePath(path, source, root); ok {
+			path = moved
+		}
+		fs.mu.Lock()
+		removed := fs.isRemoved(path)
+		fs.mu.Unlock()
+		if removed && info != nil && info.IsDir() {
+			return filepath.SkipDir
+		} else if removed {
+			return nil
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// source returns where a path is on the wrapped filesystem, before the renames
+func (fs *DryRunFs) source(path string) string {
+	for i := len(fs.renamed) - 1; i >= 0; i-- {
+		if moved, ok := movePath(path, fs.renamed[i][1], fs.renamed[i][0]); ok {
+			path = moved
+		}
+	}
+	return path
+}
+
+// movePath returns the path in newPath of a path in oldPath
+func movePath(path, oldPath, newPath string) (moved string, ok bool) {
+	if path == oldPath {
+		return newPath, true
+	} else if strings.HasPrefix(path, oldPath+string(filepath.Separator)) {
+		return newPath + strings.TrimPrefix(path, oldPath), true
+	}
+	return path, false
+}
+
+// isRemoved checks if a path is in a file or directory that would be removed
+func (fs *DryRunFs) isRemoved(path string) bool {
+	for _, removed := range fs.removed {
+		if path == removed || strings.HasPrefix(path, removed+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // ExecI defines methods to run commands
 type ExecI interface {
-	GoCommand(absolutePath string, args ...string) error
-	BashCommand(absolutePath, script string) error
+	GoCommand(ctx context.Context, absolutePath string, opts ExecOptions, args ...string) (result ExecResult, err error)
+	BashCommand(ctx context.Context, absolutePath, script string, opts ExecOptions) (result ExecResult, err error)
+	Command(ctx context.Context, absolutePath string, argv []string, opts ExecOptions) (result ExecResult, err error)
+	GitCommand(ctx context.Context, absolutePath string, args ...string) (output string, err error)
+}
+
+// ExecOptions contains the options of a command
+type ExecOptions struct {
+	Stdout io.Writer // where the output is streamed, defaults to the stdout of the process when nil
+	Stderr io.Writer // where the errors are streamed, defaults to the stderr of the process when nil
+	Env    []string  // variables added to the environment of the process, as KEY=value
+	Shell  string    // shell running scripts with -c, defaults to /bin/sh
+	// Capture keeps the output in the result, the command then writes to pipes and is waited for
+	// until every process it started in the background has closed them
+	Capture bool
+}
+
+// ExecResult contains the outcome of a command
+type ExecResult struct {
+	ExitCode int
+	Duration time.Duration
+	Stdout   string // captured output, with the Capture option
+	Stderr   string // captured errors, with the Capture option
 }
 
+// interruptGracePeriod is the time scripts have to stop after gorepo forwarded them a signal,
+// a variable so that tests do not wait for it
+var interruptGracePeriod = 10 * time.Second
+
 // Exec implements ExecI
 type Exec struct{}
 
 var _ ExecI = &Exec{}
 
 // GoCommand runs a go command in a given directory
-func (x *Exec) GoCommand(absolutePath string, args ...string) (err error) {
-	cmd := exec.Command("go", args...)
+func (x *Exec) GoCommand(ctx context.Context, absolutePath string, opts ExecOptions, args ...string) (result ExecResult, err error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = absolutePath
-	output, err := cmd.CombinedOutput()
+	result, err = runCommand(cmd, opts)
 	if err != nil {
-		return fmt.Errorf("failed to run command: %w\nOutput: %s", err, string(output))
+		return result, fmt.Errorf("failed to run go %s in %s: %w", strings.Join(args, " "), absolutePath, err)
 	}
-	return nil
+	return result, nil
 }
 
 // BashCommand runs a bash script in a given directory
-func (x *Exec) BashCommand(absolutePath, script string) (err error) {
+func (x *Exec) BashCommand(ctx context.Context, absolutePath, script string, opts ExecOptions) (result ExecResult, err error) {
+	shell := opts.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return x.Command(ctx, absolutePath, []string{shell, "-c", script}, opts)
+}
+
+// Command runs a program with its arguments in a given directory, without a shell
+func (x *Exec) Command(ctx context.Context, absolutePath string, argv []string, opts ExecOptions) (result ExecResult, err error) {
 	if _, err := os.Stat(absolutePath); os.IsNotExist(err) {
-		return fmt.Errorf("directory does not exist: %s", absolutePath)
+		return result, fmt.Errorf("directory does not exist: %s", absolutePath)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = absolutePath
+	// the command runs in its own process group, so that the processes it starts are stopped with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var interruptedAt time.Time
+	cmd.Cancel = func() error {
+		var interrupt *interruptError
+		if errors.As(context.Cause(ctx), &interrupt) {
+			// forward the signal, the processes still running after the grace period are killed below
+			interruptedAt = time.Now()
+			sig, _ := interrupt.Signal.(syscall.Signal)
+			return syscall.Kill(-cmd.Process.Pid, sig)
+		}
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 	}
-	cmd := exec.Command("/bin/sh", "-c", script)
+	// do not wait for the output of the processes of the group after the grace period
+	cmd.WaitDelay = interruptGracePeriod
+	result, err = runCommand(cmd, opts)
+	if !interruptedAt.IsZero() {
+		// processes of the group can outlive the script, they get what remains of the grace period
+		for time.Since(interruptedAt) < interruptGracePeriod && syscall.Kill(-cmd.Process.Pid, 0) == nil {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to run command in %s: %w", absolutePath, err)
+	}
+	return result, nil
+}
+
+// GitCommand runs a git command in a given directory and returns its output
+func (x *Exec) GitCommand(ctx context.Context, absolutePath string, args ...string) (output string, err error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = absolutePath
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run command in %s: %w", absolutePath, err)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run git %s: %w\nOutput: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out), nil
+}
+
+// runCommand runs a command, streams its output to the writers of the options and captures it when asked
+// Without writers, the command gets the stdout and stderr of the process, so that gorepo does not wait
+// for the processes it started in the background
+func runCommand(cmd *exec.Cmd, opts ExecOptions) (result ExecResult, err error) {
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	var capturedStdout, capturedStderr bytes.Buffer
+	if opts.Capture {
+		stdout = io.MultiWriter(stdout, &capturedStdout)
+		stderr = io.MultiWriter(stderr, &capturedStderr)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	start := time.Now()
+	err = cmd.Run()
+	return ExecResult{
+		ExitCode: exitCode(err),
+		Duration: time.Since(start),
+		Stdout:   capturedStdout.String(),
+		Stderr:   capturedStderr.String(),
+	}, err
+}
+
+// DryRunExec implements ExecI, it only logs the go commands and scripts that would run
+// Git commands only read the repository, so they still run
+type DryRunExec struct {
+	Exec   ExecI
+	Logger LlogI
+}
+
+var _ ExecI = &DryRunExec{}
+
+// NewDryRunExec returns an instance of DryRunExec
+func NewDryRunExec(x ExecI, logger LlogI) *DryRunExec {
+	return &DryRunExec{
+		Exec:   x,
+		Logger: logger,
+	}
+}
+
+// GoCommand logs the go command that would run
+func (x *DryRunExec) GoCommand(ctx context.Context, absolutePath string, opts ExecOptions, args ...string) (result ExecResult, err error) {
+	x.Logger.InfoLn("dry run: would run 'go " + strings.Join(args, " ") + "' in " + absolutePath)
+	return result, nil
+}
+
+// BashCommand logs the script that would run
+func (x *DryRunExec) BashCommand(ctx context.Context, absolutePath, script string, opts ExecOptions) (result ExecResult, err error) {
+	x.Logger.InfoLn("dry run: would run '" + script + "' in " + absolutePath)
+	return result, nil
+}
+
+// Command logs the command that would run
+func (x *DryRunExec) Command(ctx context.Context, absolutePath string, argv []string, opts ExecOptions) (result ExecResult, err error) {
+	x.Logger.InfoLn("dry run: would run '" + shellJoin(argv) + "' in " + absolutePath)
+	return result, nil
+}
+
+// GitCommand runs a git command with the wrapped ExecI
+func (x *DryRunExec) GitCommand(ctx context.Context, absolutePath string, args ...string) (output string, err error) {
+	return x.Exec.GitCommand(ctx, absolutePath, args...)
+}
+
+// JournalEntry is a change made through a Journal, with what is needed to revert it
+type JournalEntry struct {
+	Op      string `json:"op"`                 // write, mkdir, rename or remove
+	Path    string `json:"path"`               // path that was written, created, moved or removed
+	NewPath string `json:"new_path,omitempty"` // destination of a rename, or location in the trash of a removal
+	Existed bool   `json:"existed,omitempty"`  // whether a written file existed before
+	Content []byte `json:"content,omitempty"`  // content of a written file before it was written
+}
+
+// Journal implements FsI and ExecI, it records the changes made through the wrapped filesystem and
+// go commands so that they can be rolled back. Removed files are moved to a trash in Dir instead
+// of being deleted, and go commands are assumed to only change go.mod, go.sum, go.work and
+// go.work.sum in the directory where they run.
+type Journal struct {
+	Fs      FsI
+	Exec    ExecI
+	Root    string // changes are only expected in the monorepo
+	Dir     string // folder of the journal
+	Id      string
+	mu      sync.Mutex
+	Entries []JournalEntry
+}
+
+var _ FsI = &Journal{}
+var _ ExecI = &Journal{}
+
+// NewJournal returns an instance of Journal
+func NewJournal(fs FsI, x ExecI, root, dir string) *Journal {
+	return &Journal{
+		Fs:   fs,
+		Exec: x,
+		Root: root,
+		Dir:  dir,
+		Id:   strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+}
+
+// Exists checks if a file exists
+func (j *Journal) Exists(path string) bool {
+	return j.Fs.Exists(path)
+}
+
+// Read reads and return a file
+func (j *Journal) Read(path string) ([]byte, error) {
+	return j.Fs.Read(path)
+}
+
+// Write records the previous content of a file, then writes it
+func (j *Journal) Write(path string, content []byte) (err error) {
+	j.snapshot(path)
+	return j.Fs.Write(path, content)
+}
+
+// MkdirAll records the first directory that does not exist yet, then creates the directories
+func (j *Journal) MkdirAll(path string) (err error) {
+	created := ""
+	for dir := filepath.Clean(path); strings.HasPrefix(dir, j.Root+string(filepath.Separator)) && !j.Fs.Exists(dir); dir = filepath.Dir(dir) {
+		created = dir
+	}
+	if err := j.Fs.MkdirAll(path); err != nil {
+		return err
+	}
+	if created != "" {
+		j.record(JournalEntry{Op: "mkdir", Path: created})
+	}
+	return nil
+}
+
+// RemoveAll moves a file or a directory to the trash of the journal
+func (j *Journal) RemoveAll(path string) (err error) {
+	if !j.Fs.Exists(path) {
+		return nil
+	}
+	j.mu.Lock()
+	trashPath := filepath.Join(j.Dir, "trash", j.Id, strconv.Itoa(len(j.Entries))+"-"+filepath.Base(path))
+	j.mu.Unlock()
+	if err := j.Fs.MkdirAll(filepath.Dir(trashPath)); err != nil {
+		return err
+	}
+	if err := j.Fs.Rename(path, trashPath); err != nil {
+		return err
+	}
+	j.record(JournalEntry{Op: "remove", Path: path, NewPath: trashPath})
+	return nil
+}
+
+// Rename records and moves a file or a directory
+func (j *Journal) Rename(oldPath, newPath string) (err error) {
+	if err := j.Fs.Rename(oldPath, newPath); err != nil {
+		return err
 	}
+	j.record(JournalEntry{Op: "rename", Path: oldPath, NewPath: newPath})
 	return nil
 }
 
+// Walk walks the filesystem
+func (j *Journal) Walk(root string, walkFn filepath.WalkFunc) (err error) {
+	return j.Fs.Walk(root, walkFn)
+}
+
+// GoCommand records the go files of the directory, then runs a go command in it
+func (j *Journal) GoCommand(ctx context.Context, absolutePath string, opts ExecOptions, args ...string) (result ExecResult, err error) {
+	for _, file := range []string{"go.mod", "go.sum", "go.work", "go.work.sum"} {
+		j.snapshot(filepath.Join(absolutePath, file))
+	}
+	return j.Exec.GoCommand(ctx, absolutePath, opts, args...)
+}
+
+// BashCommand runs a bash script, its changes are not recorded
+func (j *Journal) BashCommand(ctx context.Context, absolutePath, script string, opts ExecOptions) (result ExecResult, err error) {
+	return j.Exec.BashCommand(ctx, absolutePath, script, opts)
+}
+
+// Command runs a command, its changes are not recorded
+func (j *Journal) Command(ctx context.Context, absolutePath string, argv []string, opts ExecOptions) (result ExecResult, err error) {
+	return j.Exec.Command(ctx, absolutePath, argv, opts)
+}
+
+// GitCommand runs a git command
+func (j *Journal) GitCommand(ctx context.Context, absolutePath string, args ...string) (output string, err error) {
+	return j.Exec.GitCommand(ctx, absolutePath, args...)
+}
+
+// snapshot records the content of a file before it changes
+func (j *Journal) snapshot(path string) {
+	entry := JournalEntry{Op: "write", Path: path}
+	if content, err := j.Fs.Read(path); err == nil {
+		entry.Existed = true
+		entry.Content = content
+	}
+	j.record(entry)
+}
+
+// record adds an entry to the journal
+func (j *Journal) record(entry JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Entries = append(j.Entries, entry)
+}
+
+// Changes returns the entries that changed something, writes leaving a file as it was are ignored
+func (j *Journal) Changes() (changes []JournalEntry) {
+	for _, entry := range j.Entries {
+		if entry.Op == "write" {
+			content, err := j.Fs.Read(entry.Path)
+			if (err != nil && !entry.Existed) || (err == nil && entry.Existed && bytes.Equal(content, entry.Content)) {
+				continue
+			}
+		}
+		changes = append(changes, entry)
+	}
+	return changes
+}
+
+// Rollback reverts the entries of the journal, the last one first
+func (j *Journal) Rollback() (err error) {
+	if err := revertJournalEntries(j.Fs, j.Entries); err != nil {
+		return err
+	}
+	return j.Fs.RemoveAll(filepath.Join(j.Dir, "trash", j.Id))
+}
+
+// revertJournalEntries reverts journal entries, the last one first
+func revertJournalEntries(fs FsI, entries []JournalEntry) (err error) {
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		switch entry.Op {
+		case "write":
+			if entry.Existed {
+				err = fs.Write(entry.Path, entry.Content)
+			} else {
+				err = fs.RemoveAll(entry.Path)
+			}
+		case "mkdir":
+			err = fs.RemoveAll(entry.Path)
+		case "rename", "remove":
+			if err = fs.MkdirAll(filepath.Dir(entry.Path)); err == nil {
+				err = fs.Rename(entry.NewPath, entry.Path)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to revert %s of %s: %w", entry.Op, entry.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describeJournalEntry returns a human-readable description of how an entry is reverted
+func describeJournalEntry(entry JournalEntry) string {
+	switch entry.Op {
+	case "write":
+		if entry.Existed {
+			return "restore " + entry.Path
+		}
+		return "delete " + entry.Path
+	case "mkdir":
+		return "delete directory " + entry.Path
+	default:
+		return "move " + entry.NewPath + " back to " + entry.Path
+	}
+}
+
 // LlogI defines methods to log messages
 type LlogI interface {
 	FatalLn(msg string)
@@ -167,6 +684,8 @@ func (l *Llog) Default(msg string) {
 // OsI defines methods to interact with the operating system
 type OsI interface {
 	GetWd() (dir string, err error)
+	Getenv(key string) string
+	LookupEnv(key string) (value string, ok bool)
 	AskBool(question, choices, defaultValue string, logger LlogI) (response bool, err error)
 	AskString(question, choices, defaultValue string, logger LlogI) (response string, err error)
 }
@@ -181,6 +700,16 @@ func (o *Os) GetWd() (dir string, err error) {
 	return os.Getwd()
 }
 
+// Getenv returns the value of an environment variable
+func (o *Os) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+// LookupEnv returns the value of an environment variable and whether it is set
+func (o *Os) LookupEnv(key string) (value string, ok bool) {
+	return os.LookupEnv(key)
+}
+
 // AskBool asks a question and returns a boolean
 func (o *Os) AskBool(question, choices, defaultValue string, logger LlogI) (response bool, err error) {
 	questionFormated := question
@@ -241,6 +770,9 @@ type StaticConfig struct {
 	MaxRecursion   int    // Max recursion depth to search for monorepo root
 	RootFileName   string // File name to identify the monorepo
 	ModuleFileName string // File name to identify a module
+	CacheDir       string // Folder where the results of scripts are cached, relative to the root
+	ArchiveDir     string // Folder where removed modules are archived, relative to the root
+	JournalDir     string // Folder where the changes of the last command are kept for gorepo undo, relative to the root
 }
 
 // RuntimeConfig contains runtime variables
@@ -260,13 +792,28 @@ var _ RootManipulation = &Config{}
 
 // ModuleManipulation defines methods to manipulate the module configuration
 type ModuleManipulation interface {
-	GetModules(targets, exclude []string) (modules []ModuleConfig, err error)
+	GetModules(targets, exclude []string, strict bool) (modules []ModuleConfig, err error)
+	GetModuleGraph() (graph ModuleGraph, err error)
+	FilterAffectedModules(ctx context.Context, modules []ModuleConfig, ref string) (affected []ModuleConfig, err error)
 	LoadModuleConfig(relativePath string) (cfg ModuleConfig, err error)
+	GetModuleFiles(relativePath string) (files []string, err error)
+	GetGoModFolders() (relativePaths []string, err error)
+	InferModuleType(relativePath string) (moduleType, main string, err error)
+	GetWorkspaceUses() (relativePaths []string, err error)
 	WriteModuleConfig(modConfig ModuleConfig, absolutePathAndName string) (err error)
 }
 
 var _ ModuleManipulation = &Config{}
 
+// CacheManipulation defines methods to manipulate the cache of scripts
+type CacheManipulation interface {
+	CacheKey(graph ModuleGraph, module ModuleConfig, scriptName string, script Script) (key string, err error)
+	ReadCache(key string) (entry CacheEntry, found bool, err error)
+	WriteCache(key string, entry CacheEntry) (err error)
+}
+
+var _ CacheManipulation = &Config{}
+
 // ConfigHelpers defines methods to help with the configuration
 type ConfigHelpers interface {
 	GoWorkspaceExists() bool
@@ -281,6 +828,9 @@ func NewConfig(su *SystemUtils) (cfg *Config, err error) {
 		MaxRecursion:   7,
 		RootFileName:   "work.toml",
 		ModuleFileName: "module.toml",
+		CacheDir:       filepath.Join(".gorepo", "cache"),
+		ArchiveDir:     filepath.Join(".gorepo", "archive"),
+		JournalDir:     filepath.Join(".gorepo", "journal"),
 	}
 	cfg.Runtime = RuntimeConfig{}
 	cfg.su = su
@@ -322,7 +872,18 @@ type RootConfig struct {
 	Version  string            `toml:"version"`
 	Strategy string            `toml:"strategy"` // workspace / rewrites (unsupported)
 	Vendor   bool              `toml:"vendor"`   // vendor or not (unsupported)
-	Scripts  map[string]string `toml:"scripts"`
+	Scripts  map[string]Script `toml:"scripts"`
+	Timeouts map[string]string `toml:"timeouts,omitempty"` // timeouts of the scripts given as strings, e.g. "5m"
+	Cache    CacheConfig       `toml:"cache,omitempty"`
+	Vars     map[string]string `toml:"vars,omitempty"` // variables for ${vars.NAME}, also available in module.toml
+}
+
+// CacheConfig contains the configuration of the cache of scripts
+type CacheConfig struct {
+	// Url of a remote cache shared between machines, entries are read with GET <url>/<key> and written with PUT <url>/<key>
+	Url string `toml:"url,omitempty"`
+	// Name of the environment variable containing a token sent as a bearer token to the remote cache
+	TokenEnv string `toml:"token_env,omitempty"`
 }
 
 // ModuleConfig contains the configuration of a module
@@ -337,10 +898,241 @@ type ModuleConfig struct {
 	Type string `toml:"type"`
 	// Entry point of the module, if needed to be built
 	Main string `toml:"main"`
-	// Build priority, higher goes first
+	// Build priority, lower goes first, only used between modules that do not depend on each other
 	Priority int `toml:"priority"`
+	// Timeouts of the scripts given as strings, by script name, as durations like "30s" or "5m"
+	// A script given as a table sets its timeout in the table
+	Timeouts map[string]string `toml:"timeouts,omitempty"`
+	// Tags to group modules, they can be targeted with --target=tag:<tag>
+	Tags []string `toml:"tags,omitempty"`
 	// List of scripts that can be run through gorepo execute <script_name>
-	Scripts map[string]string `toml:"scripts"`
+	Scripts map[string]Script `toml:"scripts"`
+	// Environment variables the scripts depend on, part of the cache key with --cache
+	CacheEnv []string `toml:"cache_env,omitempty"`
+	// Variables for ${vars.NAME}, they take precedence over the ones of work.toml
+	Vars map[string]string `toml:"vars,omitempty"`
+}
+
+// Script is a script of work.toml or module.toml, defined either as the command to run or as a table:
+//
+//	[scripts.test]
+//	run = "go test ./..."
+//	description = "Run the unit tests"
+//	env = { CGO_ENABLED = "0" }
+//	dir = "internal"
+//	shell = "bash"
+//	depends_on = ["generate"]
+//	timeout = "5m"
+type Script struct {
+	// Command to run
+	Run string `toml:"run"`
+	// Description shown by gorepo list --scripts
+	Description string `toml:"description,omitempty"`
+	// Environment variables added to the ones of gorepo
+	Env map[string]string `toml:"env,omitempty"`
+	// Directory where the script runs, relative to the module (or to the root)
+	Dir string `toml:"dir,omitempty"`
+	// Shell running the command with -c, sh by default
+	Shell string `toml:"shell,omitempty"`
+	// Scripts that must succeed before this one, ^ for the script of the modules it requires
+	DependsOn []string `toml:"depends_on,omitempty"`
+	// Timeout of the script, as a duration like "30s" or "5m"
+	Timeout string `toml:"timeout,omitempty"`
+}
+
+// UnmarshalText decodes a script defined as a string, tables are decoded by decodeScripts
+func (s *Script) UnmarshalText(text []byte) error {
+	*s = Script{Run: string(text)}
+	return nil
+}
+
+// execOptions returns the options to run the script with, the variables of env come after the
+// given ones, so that they take precedence, and are sorted by name
+func (s Script) execOptions(env []string, stdout, stderr io.Writer) ExecOptions {
+	opts := ExecOptions{Stdout: stdout, Stderr: stderr, Shell: s.Shell, Env: append([]string{}, env...)}
+	for _, key := range sortedKeys(s.Env) {
+		opts.Env = append(opts.Env, key+"="+s.Env[key])
+	}
+	return opts
+}
+
+// standardEnv returns the variables gorepo exports to what it runs in a module, the root being a
+// module without relative path. scriptName is empty for commands run with gorepo exec.
+func standardEnv(root string, rootConfig RootConfig, module ModuleConfig, scriptName string) (env []string) {
+	env = []string{
+		"GOREPO_ROOT=" + root,
+		"GOREPO_MONOREPO_NAME=" + rootConfig.Name,
+		"GOREPO_MONOREPO_VERSION=" + rootConfig.Version,
+	}
+	if module.RelativePath != "" {
+		env = append(env,
+			"GOREPO_MODULE_NAME="+module.Name,
+			"GOREPO_MODULE_PATH="+filepath.ToSlash(module.RelativePath),
+			"GOREPO_MODULE_TYPE="+module.Type,
+			"GOREPO_MODULE_MAIN="+module.Main,
+		)
+	}
+	if scriptName != "" {
+		env = append(env, "GOREPO_SCRIPT="+scriptName)
+	}
+	return env
+}
+
+// dir returns the directory where the script runs, from the directory of the module or of the root
+func (s Script) dir(base string) string {
+	return filepath.Join(base, s.Dir)
+}
+
+// decodeScripts decodes the scripts section of a toml file, where a script is a string or a table
+func decodeScripts(content []byte) (scripts map[string]Script, err error) {
+	var raw struct {
+		Scripts  map[string]any    `toml:"scripts"`
+		Timeouts map[string]string `toml:"timeouts"`
+	}
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	scripts = map[string]Script{}
+	for name, value := range raw.Scripts {
+		switch value := value.(type) {
+		case string:
+			// a script given as a string can only get a timeout from the timeouts section
+			scripts[name] = Script{Run: value, Timeout: raw.Timeouts[name]}
+		case map[string]any:
+			if _, ok := raw.Timeouts[name]; ok {
+				return nil, errors.New("timeout of script " + name + " in the timeouts section, set it in its table instead")
+			}
+			table, err := toml.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			var script Script
+			decoder := toml.NewDecoder(bytes.NewReader(table))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&script); err != nil {
+				var strictErr *toml.StrictMissingError
+				if errors.As(err, &strictErr) {
+					var fields []string
+					for _, e := range strictErr.Errors {
+						fields = append(fields, strings.Join(e.Key(), "."))
+					}
+					return nil, errors.New("unknown field " + strings.Join(fields, ", ") + " in script " + name)
+				}
+				return nil, fmt.Errorf("invalid script %s: %w", name, err)
+			}
+			scripts[name] = script
+		default:
+			return nil, errors.New("invalid script " + name + ", expected a string or a table")
+		}
+	}
+	return scripts, nil
+}
+
+// interpolate expands the variables in the values of a toml file: the given ones (like root.name),
+// ${env.NAME} and ${vars.NAME} for the [vars] table of the file. The [vars] table can use the given
+// variables but not its own ones. $${ is replaced by ${, and ${...} not starting with root., module.,
+// env. or vars. is left for the shell.
+func (c *Config) interpolate(content []byte, variables map[string]string) (expanded []byte, err error) {
+	var raw map[string]any
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	lookup := func(name string) (string, bool) {
+		if env, ok := strings.CutPrefix(name, "env."); ok {
+			return c.su.Os.LookupEnv(env)
+		}
+		value, ok := variables[name]
+		return value, ok
+	}
+	if vars, ok := raw["vars"].(map[string]any); ok {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fileVariables := map[string]string{}
+		for _, name := range names {
+			value, ok := vars[name].(string)
+			if !ok {
+				return nil, errors.New("invalid variable vars." + name + ", expected a string")
+			}
+			if value, err = expandVariables(value, "vars."+name, lookup); err != nil {
+				return nil, err
+			}
+			vars[name] = value
+			fileVariables["vars."+name] = value
+		}
+		// lookup sees the variables of the file from now on
+		variables = maps.Clone(variables)
+		maps.Copy(variables, fileVariables)
+	}
+	var expand func(value any, key string) (any, error)
+	expand = func(value any, key string) (any, error) {
+		switch value := value.(type) {
+		case string:
+			return expandVariables(value, key, lookup)
+		case map[string]any:
+			keys := make([]string, 0, len(value))
+			for k := range value {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if key == "" && k == "vars" {
+					continue
+				}
+				if value[k], err = expand(value[k], strings.TrimPrefix(key+"."+k, ".")); err != nil {
+					return nil, err
+				}
+			}
+		case []any:
+			for i, v := range value {
+				if value[i], err = expand(v, key+"["+strconv.Itoa(i)+"]"); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return value, nil
+	}
+	if _, err := expand(raw, ""); err != nil {
+		return nil, err
+	}
+	return toml.Marshal(raw)
+}
+
+// expandVariables expands the ${prefix.name} of a value, key is the key of the value in the file
+func expandVariables(value, key string, lookup func(name string) (string, bool)) (expanded string, err error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i < 0 {
+			b.WriteString(value)
+			return b.String(), nil
+		}
+		if i > 0 && value[i-1] == '$' {
+			b.WriteString(value[:i-1] + "${")
+			value = value[i+2:]
+			continue
+		}
+		b.WriteString(value[:i])
+		end := strings.Index(value[i:], "}")
+		name := ""
+		if end > 0 {
+			name = value[i+2 : i+end]
+		}
+		if !strings.HasPrefix(name, "root.") && !strings.HasPrefix(name, "module.") &&
+			!strings.HasPrefix(name, "env.") && !strings.HasPrefix(name, "vars.") {
+			b.WriteString("${")
+			value = value[i+2:]
+			continue
+		}
+		resolved, ok := lookup(name)
+		if !ok {
+			return "", errors.New("undefined variable ${" + name + "} in " + key)
+		}
+		b.WriteString(resolved)
+		value = value[i+end+1:]
+	}
 }
 
 // RootConfigExists checks if a file work.toml exists at the root
@@ -355,10 +1147,26 @@ func (c *Config) LoadRootConfig() (cfg RootConfig, err error) {
 	if err != nil {
 		return cfg, err
 	}
+	if bytes.Contains(file, []byte("${")) {
+		var raw struct {
+			Name    string `toml:"name"`
+			Version string `toml:"version"`
+		}
+		if err := toml.Unmarshal(file, &raw); err != nil {
+			return cfg, err
+		}
+		variables := map[string]string{"root.name": raw.Name, "root.version": raw.Version}
+		if file, err = c.interpolate(file, variables); err != nil {
+			return cfg, fmt.Errorf("%s: %w", c.Static.RootFileName, err)
+		}
+	}
 	err = toml.Unmarshal(file, &cfg)
 	if err != nil {
 		return cfg, err
 	}
+	if cfg.Scripts, err = decodeScripts(file); err != nil {
+		return cfg, fmt.Errorf("%s: %w", c.Static.RootFileName, err)
+	}
 	return cfg, nil
 }
 
@@ -378,8 +1186,10 @@ func (c *Config) GoWorkspaceExists() bool {
 	return c.su.Fs.Exists(filePath)
 }
 
-// GetModules returns all modules in the monorepo in alphabetical order
-func (c *Config) GetModules(targets, exclude []string) (modules []ModuleConfig, err error) {
+// GetModules returns the modules of the monorepo matched by the targets and not by the excludes,
+// sorted by priority then name. Targets and excludes are selectors (see matchSelector).
+// Unknown targets are errors, unknown excludes are warnings unless strict is true.
+func (c *Config) GetModules(targets, exclude []string, strict bool) (modules []ModuleConfig, err error) {
 	// validation
 	for _, target := range targets {
 		if target == "root" && len(targets) > 1 {
@@ -396,12 +1206,17 @@ func (c *Config) GetModules(targets, exclude []string) (modules []ModuleConfig,
 		}
 	}
 	// walk
+	var allModules []ModuleConfig
 	currentPath := c.Runtime.ROOT
 	err = c.su.Fs.Walk(currentPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
+			// removed, archived and cached modules are kept in .gorepo
+			if path != c.Runtime.ROOT && (info.Name() == ".git" || info.Name() == ".gorepo") {
+				return filepath.SkipDir
+			}
 			exists := c.su.Fs.Exists(filepath.Join(path, c.Static.ModuleFileName))
 			if exists {
 				relativePath, err := filepath.Rel(c.Runtime.ROOT, path)
@@ -412,9 +1227,7 @@ func (c *Config) GetModules(targets, exclude []string) (modules []ModuleConfig,
 				if err != nil {
 					return err
 				}
-				if (targets[0] == "all" || contains(targets, moduleConfig.Name)) && !contains(exclude, moduleConfig.Name) {
-					modules = append(modules, moduleConfig)
-				}
+				allModules = append(allModules, moduleConfig)
 			}
 		}
 		return nil
@@ -423,15 +1236,637 @@ func (c *Config) GetModules(targets, exclude []string) (modules []ModuleConfig,
 		c.su.Logger.WarningLn(err.Error())
 		return modules, err
 	}
+	// unknown selectors
+	if unknown := unknownSelectors(allModules, targets); len(unknown) > 0 {
+		return nil, errors.New("unknown target " + strings.Join(unknown, "\nunknown target "))
+	}
+	if unknown := unknownSelectors(allModules, exclude); len(unknown) > 0 {
+		if strict {
+			return nil, errors.New("unknown exclude " + strings.Join(unknown, "\nunknown exclude "))
+		}
+		for _, u := range unknown {
+			c.su.Logger.WarningLn("unknown exclude " + u)
+		}
+	}
+	// select
+	var graph *ModuleGraph
+	getGraph := func() (ModuleGraph, error) {
+		if graph == nil {
+			g, err := c.GetModuleGraph()
+			if err != nil {
+				return g, err
+			}
+			graph = &g
+		}
+		return *graph, nil
+	}
+	targeted, err := c.matchSelectors(allModules, targets, getGraph)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := c.matchSelectors(allModules, exclude, getGraph)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range allModules {
+		if targeted[module.RelativePath] && !excluded[module.RelativePath] {
+			modules = append(modules, module)
+		}
+	}
 	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Priority != modules[j].Priority {
+			return modules[i].Priority < modules[j].Priority
+		}
 		return modules[i].Name < modules[j].Name
 	})
-	sort.Slice(modules, func(i, j int) bool {
-		return modules[i].Priority < modules[j].Priority
-	})
 	return modules, nil
 }
 
+// unknownSelectors returns the terms of the selectors that do not match any module, each followed by
+// suggestions of close names when there are some
+func unknownSelectors(modules []ModuleConfig, selectors []string) (unknown []string) {
+	for _, selector := range selectors {
+		if selector == "" {
+			continue
+		}
+		for _, term := range strings.Split(selector, "+") {
+			kind, value, hasKind := strings.Cut(term, ":")
+			if !hasKind {
+				kind, value = "name", term
+			}
+			if value == "" || (kind == "name" && value == "all") || !contains([]string{"name", "tag", "path", "type", "deps-of", "dependents-of"}, kind) {
+				// unknown kinds are reported by matchTerm
+				continue
+			}
+			var candidates []string
+			for _, module := range modules {
+				switch kind {
+				case "name":
+					candidates = append(candidates, module.Name)
+				case "tag":
+					candidates = append(candidates, module.Tags...)
+				case "path":
+					candidates = append(candidates, filepath.ToSlash(module.RelativePath))
+				case "type":
+					candidates = append(candidates, module.Type)
+				case "deps-of", "dependents-of":
+					candidates = append(candidates, module.Name, filepath.ToSlash(module.RelativePath))
+				}
+			}
+			found := false
+			for _, candidate := range candidates {
+				if kind == "deps-of" || kind == "dependents-of" {
+					found = candidate == filepath.ToSlash(filepath.Clean(value))
+				} else {
+					found, _ = path.Match(value, candidate)
+				}
+				if found {
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			message := "'" + term + "'"
+			if suggestions := suggest(value, candidates); len(suggestions) > 0 {
+				prefix := ""
+				if hasKind {
+					prefix = kind + ":"
+				}
+				for i := range suggestions {
+					suggestions[i] = "'" + prefix + suggestions[i] + "'"
+				}
+				message += ", did you mean " + strings.Join(suggestions, " or ") + "?"
+			}
+			unknown = append(unknown, message)
+		}
+	}
+	return unknown
+}
+
+// suggest returns up to 3 candidates close to a value, the closest first
+func suggest(value string, candidates []string) (suggestions []string) {
+	scores := map[string]float64{}
+	for _, candidate := range candidates {
+		if score := smetrics.JaroWinkler(value, candidate, 0.7, 4); score >= 0.8 {
+			scores[candidate] = score
+		}
+	}
+	for candidate := range scores {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if scores[suggestions[i]] != scores[suggestions[j]] {
+			return scores[suggestions[i]] > scores[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+	return suggestions
+}
+
+// matchSelectors returns the relative paths of the modules matched by at least one of the selectors
+func (c *Config) matchSelectors(modules []ModuleConfig, selectors []string, getGraph func() (ModuleGraph, error)) (matched map[string]bool, err error) {
+	matched = map[string]bool{}
+	for _, selector := range selectors {
+		if selector == "" {
+			continue
+		}
+		selectorMatched, err := c.matchSelector(modules, selector, getGraph)
+		if err != nil {
+			return nil, err
+		}
+		for relativePath := range selectorMatched {
+			matched[relativePath] = true
+		}
+	}
+	return matched, nil
+}
+
+// matchSelector returns the relative paths of the modules matched by a selector. A selector is one or
+// several terms joined with '+' (intersection), a term being one of:
+//   - all:                   every module
+//   - <glob>:                modules whose name matches the glob, e.g. api or api-*
+//   - tag:<glob>:            modules with a tag matching the glob
+//   - path:<glob>:           modules whose relative path matches the glob, e.g. services/*
+//   - type:<glob>:           modules whose type matches the glob, e.g. executable
+//   - deps-of:<module>:      modules a module depends on, directly or not
+//   - dependents-of:<module> modules depending on a module, directly or not
+func (c *Config) matchSelector(modules []ModuleConfig, selector string, getGraph func() (ModuleGraph, error)) (matched map[string]bool, err error) {
+	for i, term := range strings.Split(selector, "+") {
+		termMatched, err := c.matchTerm(modules, term, getGraph)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			matched = termMatched
+			continue
+		}
+		for relativePath := range matched {
+			if !termMatched[relativePath] {
+				delete(matched, relativePath)
+			}
+		}
+	}
+	return matched, nil
+}
+
+// matchTerm returns the relative paths of the modules matched by a term of a selector
+func (c *Config) matchTerm(modules []ModuleConfig, term string, getGraph func() (ModuleGraph, error)) (matched map[string]bool, err error) {
+	matched = map[string]bool{}
+	kind, value, hasKind := strings.Cut(term, ":")
+	if !hasKind {
+		kind, value = "name", term
+	}
+	if value == "" {
+		return nil, errors.New("invalid selector '" + term + "', a value is expected")
+	}
+	switch kind {
+	case "name", "tag", "path", "type":
+		for _, module := range modules {
+			var candidates []string
+			switch kind {
+			case "name":
+				candidates = []string{module.Name}
+			case "tag":
+				candidates = module.Tags
+			case "path":
+				candidates = []string{filepath.ToSlash(module.RelativePath)}
+			case "type":
+				candidates = []string{module.Type}
+			}
+			for _, candidate := range candidates {
+				ok, err := path.Match(value, candidate)
+				if err != nil {
+					return nil, errors.New("invalid pattern in selector '" + term + "'")
+				}
+				if ok || (kind == "name" && value == "all") {
+					matched[module.RelativePath] = true
+				}
+			}
+		}
+	case "deps-of", "dependents-of":
+		graph, err := getGraph()
+		if err != nil {
+			return nil, err
+		}
+		module, err := graph.find(value)
+		if err != nil {
+			return nil, err
+		}
+		relatives := graph.transitiveDeps(module.RelativePath)
+		if kind == "dependents-of" {
+			relatives = graph.transitiveDependents(module.RelativePath)
+		}
+		for _, relativePath := range relatives {
+			matched[relativePath] = true
+		}
+	default:
+		return nil, errors.New("invalid selector '" + term + "', expected tag:, path:, type:, deps-of: or dependents-of:")
+	}
+	return matched, nil
+}
+
+// ModuleGraph contains the dependencies between the modules of the monorepo, based on their go.mod
+type ModuleGraph struct {
+	Modules     []ModuleConfig      // all modules of the monorepo
+	ModulePaths map[string]string   // relative path of a module -> module path declared in its go.mod
+	Deps        map[string][]string // relative path of a module -> relative paths of the local modules it requires
+}
+
+// GetModuleGraph parses the go.mod of every module and returns the graph of local requirements
+func (c *Config) GetModuleGraph() (graph ModuleGraph, err error) {
+	modules, err := c.GetModules([]string{"all"}, []string{}, false)
+	if err != nil {
+		return graph, err
+	}
+	graph = ModuleGraph{
+		Modules:     modules,
+		ModulePaths: map[string]string{},
+		Deps:        map[string][]string{},
+	}
+	requires := map[string][]string{}
+	relativePaths := map[string]string{}
+	for _, module := range modules {
+		goModPath := filepath.Join(c.Runtime.ROOT, module.RelativePath, "go.mod")
+		if !c.su.Fs.Exists(goModPath) {
+			continue
+		}
+		content, err := c.su.Fs.Read(goModPath)
+		if err != nil {
+			return graph, err
+		}
+		modulePath, moduleRequires := parseGoMod(content)
+		graph.ModulePaths[module.RelativePath] = modulePath
+		requires[module.RelativePath] = moduleRequires
+		relativePaths[modulePath] = module.RelativePath
+	}
+	for _, module := range modules {
+		for _, required := range requires[module.RelativePath] {
+			if relativePath, ok := relativePaths[required]; ok && relativePath != module.RelativePath {
+				graph.Deps[module.RelativePath] = append(graph.Deps[module.RelativePath], relativePath)
+			}
+		}
+	}
+	return graph, nil
+}
+
+// FilterAffectedModules keeps the modules with files changed since a git ref, and the modules depending on them.
+// Without ref, changes are compared to the merge-base of HEAD and main.
+func (c *Config) FilterAffectedModules(ctx context.Context, modules []ModuleConfig, ref string) (affected []ModuleConfig, err error) {
+	if ref == "" {
+		ref, err = c.mergeBaseWithMain(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	diff, err := c.su.Exec.GitCommand(ctx, c.Runtime.ROOT, "diff", "--name-only", "-z", "--relative", ref)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := c.su.Exec.GitCommand(ctx, c.Runtime.ROOT, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	graph, err := c.GetModuleGraph()
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	// with -z, git separates paths with NUL and does not quote paths with spaces or non-ASCII characters
+	for _, file := range strings.Split(diff+untracked, "\x00") {
+		if file == "" {
+			continue
+		}
+		if relativePath, ok := graph.owner(filepath.FromSlash(file)); ok {
+			changed[relativePath] = true
+		}
+	}
+	for relativePath := range changed {
+		for _, dependent := range graph.transitiveDependents(relativePath) {
+			changed[dependent] = true
+		}
+	}
+	for _, module := range modules {
+		if changed[module.RelativePath] {
+			affected = append(affected, module)
+		}
+	}
+	return affected, nil
+}
+
+// mergeBaseWithMain returns the commit where HEAD forked from main (or origin/main)
+func (c *Config) mergeBaseWithMain(ctx context.Context) (ref string, err error) {
+	for _, branch := range []string{"main", "origin/main"} {
+		if output, err := c.su.Exec.GitCommand(ctx, c.Runtime.ROOT, "merge-base", "HEAD", branch); err == nil {
+			return strings.TrimSpace(output), nil
+		}
+	}
+	return "", errors.New("could not find the merge-base with main, pass a git ref with --affected=<git-ref>")
+}
+
+// owner returns the relative path of the module containing a file (relative to the root),
+// the deepest one if modules are nested
+func (g ModuleGraph) owner(file string) (relativePath string, found bool) {
+	longest := -1
+	for _, module := range g.Modules {
+		length := 0
+		if module.RelativePath != "." {
+			if file != module.RelativePath && !strings.HasPrefix(file, module.RelativePath+string(filepath.Separator)) {
+				continue
+			}
+			length = len(module.RelativePath)
+		}
+		if length > longest {
+			longest = length
+			relativePath = module.RelativePath
+		}
+	}
+	return relativePath, longest >= 0
+}
+
+// dependents returns the relative paths of the modules requiring a module directly
+func (g ModuleGraph) dependents(relativePath string) (dependents []string) {
+	for _, module := range g.Modules {
+		if contains(g.Deps[module.RelativePath], relativePath) {
+			dependents = append(dependents, module.RelativePath)
+		}
+	}
+	return dependents
+}
+
+// transitiveDependents returns the relative paths of all the modules depending on a module
+func (g ModuleGraph) transitiveDependents(relativePath string) (dependents []string) {
+	visited := map[string]bool{relativePath: true}
+	queue := []string{relativePath}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, module := range g.Modules {
+			if !visited[module.RelativePath] && contains(g.Deps[module.RelativePath], current) {
+				visited[module.RelativePath] = true
+				dependents = append(dependents, module.RelativePath)
+				queue = append(queue, module.RelativePath)
+			}
+		}
+	}
+	return dependents
+}
+
+// parseGoMod returns the module path and the required module paths declared in a go.mod
+func parseGoMod(content []byte) (modulePath string, requires []string) {
+	inRequireBlock := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inRequireBlock && fields[0] == ")":
+			inRequireBlock = false
+		case inRequireBlock:
+			requires = append(requires, strings.Trim(fields[0], "\"`"))
+		case fields[0] == "module" && len(fields) > 1:
+			modulePath = strings.Trim(fields[1], "\"`")
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inRequireBlock = true
+		case fields[0] == "require" && len(fields) > 1:
+			requires = append(requires, strings.Trim(fields[1], "\"`"))
+		}
+	}
+	return modulePath, requires
+}
+
+// Sort returns the modules in topological order (dependencies first), and for each of them
+// the indexes of the returned modules it depends on, directly or through modules not passed.
+// Modules that do not depend on each other keep their relative order.
+func (g ModuleGraph) Sort(modules []ModuleConfig) (sorted []ModuleConfig, deps [][]int, err error) {
+	var roots []string
+	for _, module := range modules {
+		roots = append(roots, module.RelativePath)
+	}
+	if cycle := g.findCycle(roots); len(cycle) > 0 {
+		return nil, nil, errors.New("dependency cycle between modules: " + strings.Join(cycle, " -> "))
+	}
+	indexes := map[string]int{}
+	for i, module := range modules {
+		indexes[module.RelativePath] = i
+	}
+	pending := make([][]int, len(modules))
+	for i, module := range modules {
+		for _, dep := range g.transitiveDeps(module.RelativePath) {
+			if j, ok := indexes[dep]; ok {
+				pending[i] = append(pending[i], j)
+			}
+		}
+	}
+	position := make([]int, len(modules))
+	placed := make([]bool, len(modules))
+	for len(sorted) < len(modules) {
+		for i, module := range modules {
+			if placed[i] || !allPlaced(placed, pending[i]) {
+				continue
+			}
+			placed[i] = true
+			position[i] = len(sorted)
+			sorted = append(sorted, module)
+			break
+		}
+	}
+	deps = make([][]int, len(modules))
+	for i := range modules {
+		for _, j := range pending[i] {
+			deps[position[i]] = append(deps[position[i]], position[j])
+		}
+	}
+	return sorted, deps, nil
+}
+
+func allPlaced(placed []bool, indexes []int) bool {
+	for _, i := range indexes {
+		if !placed[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// transitiveDeps returns the relative paths of all the modules a module depends on
+func (g ModuleGraph) transitiveDeps(relativePath string) (deps []string) {
+	visited := map[string]bool{relativePath: true}
+	queue := []string{relativePath}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range g.Deps[current] {
+			if !visited[dep] {
+				visited[dep] = true
+				deps = append(deps, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// findCycle returns the names of the modules forming a cycle reachable from the given modules, if any
+func (g ModuleGraph) findCycle(roots []string) (cycle []string) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var stack []string
+	var visit func(relativePath string) bool
+	visit = func(relativePath string) bool {
+		state[relativePath] = visiting
+		stack = append(stack, relativePath)
+		for _, dep := range g.Deps[relativePath] {
+			if state[dep] == visiting {
+				for i, p := range stack {
+					if p == dep {
+						for _, p := range append(stack[i:], dep) {
+							cycle = append(cycle, g.name(p))
+						}
+						return true
+					}
+				}
+			}
+			if state[dep] == unvisited && visit(dep) {
+				return true
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[relativePath] = visited
+		return false
+	}
+	for _, root := range roots {
+		if state[root] == unvisited && visit(root) {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// find returns the module with the given name or relative path
+func (g ModuleGraph) find(nameOrPath string) (module ModuleConfig, err error) {
+	var matches []ModuleConfig
+	for _, m := range g.Modules {
+		if m.RelativePath == filepath.Clean(nameOrPath) {
+			return m, nil
+		} else if m.Name == nameOrPath {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return module, errors.New("module " + nameOrPath + " not found")
+	} else if len(matches) > 1 {
+		var paths []string
+		for _, m := range matches {
+			paths = append(paths, m.RelativePath)
+		}
+		return module, errors.New("several modules are named " + nameOrPath + ", use the relative path instead: " + strings.Join(paths, ", "))
+	}
+	return matches[0], nil
+}
+
+// scriptTask is a script to run in a module, with the indexes of the tasks it waits for
+type scriptTask struct {
+	Module     ModuleConfig
+	ScriptName string
+	Script     Script
+	Deps       []int
+}
+
+// ScriptTasks expands a script over modules sorted by Sort into the graph of tasks needed to run it.
+// A script runs after the scripts listed in its depends_on: `generate` is the script of the same module,
+// `^build` is the script of every module it requires (modules without that script are ignored).
+// The script of a module also waits for the script of the modules it depends on, as given by deps.
+// Tasks are returned in an order where the dependencies of a task come before it.
+func (g ModuleGraph) ScriptTasks(modules []ModuleConfig, deps [][]int, scriptName string) (tasks []scriptTask, err error) {
+	indexes := map[string]int{}
+	visiting := map[string]bool{}
+	var stack, labels []string
+	var visit func(module ModuleConfig, name string) (int, error)
+	visit = func(module ModuleConfig, name string) (int, error) {
+		key := module.RelativePath + ":" + name
+		if i, ok := indexes[key]; ok {
+			return i, nil
+		}
+		label := module.Name + ":" + name
+		if visiting[key] {
+			for i, k := range stack {
+				if k == key {
+					return 0, errors.New("dependency cycle between scripts: " + strings.Join(append(labels[i:], label), " -> "))
+				}
+			}
+		}
+		visiting[key] = true
+		stack = append(stack, key)
+		labels = append(labels, label)
+		script := module.Scripts[name]
+		var taskDeps []int
+		for _, dependsOn := range script.DependsOn {
+			if upstreamName, ok := strings.CutPrefix(dependsOn, "^"); ok {
+				for _, relativePath := range g.Deps[module.RelativePath] {
+					upstream, err := g.find(relativePath)
+					if err != nil {
+						return 0, err
+					}
+					if upstream.Scripts[upstreamName].Run == "" {
+						continue
+					}
+					j, err := visit(upstream, upstreamName)
+					if err != nil {
+						return 0, err
+					}
+					taskDeps = append(taskDeps, j)
+				}
+				continue
+			}
+			if module.Scripts[dependsOn].Run == "" {
+				return 0, errors.New("script " + name + " depends on " + dependsOn + ", which is missing in " + module.Name)
+			}
+			j, err := visit(module, dependsOn)
+			if err != nil {
+				return 0, err
+			}
+			taskDeps = append(taskDeps, j)
+		}
+		stack, labels = stack[:len(stack)-1], labels[:len(labels)-1]
+		delete(visiting, key)
+		indexes[key] = len(tasks)
+		tasks = append(tasks, scriptTask{Module: module, ScriptName: name, Script: script, Deps: taskDeps})
+		return indexes[key], nil
+	}
+	requested := make([]int, len(modules))
+	for i, module := range modules {
+		if requested[i], err = visit(module, scriptName); err != nil {
+			return nil, err
+		}
+		for _, j := range deps[i] {
+			tasks[requested[i]].Deps = append(tasks[requested[i]].Deps, requested[j])
+		}
+	}
+	return tasks, nil
+}
+
+// name returns the name of a module from its relative path
+func (g ModuleGraph) name(relativePath string) string {
+	for _, module := range g.Modules {
+		if module.RelativePath == relativePath {
+			return module.Name
+		}
+	}
+	return filepath.Base(relativePath)
+}
+
 // LoadModuleConfig loads the configuration of a module
 func (c *Config) LoadModuleConfig(relativePath string) (cfg ModuleConfig, err error) {
 	path := filepath.Join(c.Runtime.ROOT, relativePath, c.Static.ModuleFileName)
@@ -439,195 +1874,1887 @@ func (c *Config) LoadModuleConfig(relativePath string) (cfg ModuleConfig, err er
 	if err != nil {
 		return cfg, err
 	}
+	if bytes.Contains(file, []byte("${")) {
+		variables := map[string]string{
+			"module.name": filepath.Base(relativePath),
+			"module.path": filepath.ToSlash(relativePath),
+		}
+		if c.RootConfigExists() {
+			rootConfig, err := c.LoadRootConfig()
+			if err != nil {
+				return cfg, err
+			}
+			variables["root.name"] = rootConfig.Name
+			variables["root.version"] = rootConfig.Version
+			for name, value := range rootConfig.Vars {
+				variables["vars."+name] = value
+			}
+		}
+		if file, err = c.interpolate(file, variables); err != nil {
+			return cfg, fmt.Errorf("%s: %w", filepath.Join(relativePath, c.Static.ModuleFileName), err)
+		}
+	}
 	err = toml.Unmarshal(file, &cfg)
 	if err != nil {
 		return cfg, err
 	}
-	cfg.Name = filepath.Base(relativePath)
-	cfg.RelativePath = relativePath
-	return cfg, nil
+	if cfg.Scripts, err = decodeScripts(file); err != nil {
+		return cfg, fmt.Errorf("%s: %w", filepath.Join(relativePath, c.Static.ModuleFileName), err)
+	}
+	cfg.Name = filepath.Base(relativePath)
+	cfg.RelativePath = relativePath
+	return cfg, nil
+}
+
+// GetModuleFiles returns the absolute paths of the files of a module, sorted, without the files
+// of nested modules and of .git and .gorepo folders
+func (c *Config) GetModuleFiles(relativePath string) (files []string, err error) {
+	root := filepath.Join(c.Runtime.ROOT, relativePath)
+	err = c.su.Fs.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && (info.Name() == ".git" || info.Name() == ".gorepo" ||
+				c.su.Fs.Exists(filepath.Join(path, c.Static.ModuleFileName))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// GetGoModFolders returns the relative paths of all folders containing a go.mod, without looking
+// into hidden, vendor and testdata folders
+func (c *Config) GetGoModFolders() (relativePaths []string, err error) {
+	err = c.su.Fs.Walk(c.Runtime.ROOT, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != c.Runtime.ROOT && (strings.HasPrefix(info.Name(), ".") || info.Name() == "vendor" || info.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if c.su.Fs.Exists(filepath.Join(path, "go.mod")) {
+			relativePath, err := filepath.Rel(c.Runtime.ROOT, path)
+			if err != nil {
+				return err
+			}
+			relativePaths = append(relativePaths, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(relativePaths)
+	return relativePaths, nil
+}
+
+// GetWorkspaceUses returns the relative paths listed in the use directives of go.work
+func (c *Config) GetWorkspaceUses() (relativePaths []string, err error) {
+	content, err := c.su.Fs.Read(filepath.Join(c.Runtime.ROOT, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	return parseGoWork(content), nil
+}
+
+// parseGoWork returns the paths listed in the use directives of a go.work
+func parseGoWork(content []byte) (uses []string) {
+	inUseBlock := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inUseBlock && fields[0] == ")":
+			inUseBlock = false
+		case inUseBlock:
+			uses = append(uses, filepath.Clean(strings.Trim(fields[0], "\"`")))
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inUseBlock = true
+		case fields[0] == "use" && len(fields) > 1:
+			uses = append(uses, filepath.Clean(strings.Trim(fields[1], "\"`")))
+		}
+	}
+	return uses
+}
+
+// InferModuleType returns executable and the folder of the main package (relative to the module)
+// if the module has a main package at its root or in cmd/*, library otherwise
+func (c *Config) InferModuleType(relativePath string) (moduleType, main string, err error) {
+	files, err := c.GetModuleFiles(relativePath)
+	if err != nil {
+		return "", "", err
+	}
+	root := filepath.Join(c.Runtime.ROOT, relativePath)
+	var mainDirs []string
+	for _, file := range files {
+		dir, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return "", "", err
+		}
+		isCandidate := dir == "." || filepath.Dir(dir) == "cmd"
+		if !isCandidate || filepath.Ext(file) != ".go" || strings.HasSuffix(file, "_test.go") || contains(mainDirs, dir) {
+			continue
+		}
+		content, err := c.su.Fs.Read(file)
+		if err != nil {
+			return "", "", err
+		}
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, content, parser.PackageClauseOnly)
+		if err == nil && parsed.Name.Name == "main" {
+			mainDirs = append(mainDirs, dir)
+		}
+	}
+	if len(mainDirs) == 0 {
+		return "library", "", nil
+	}
+	sort.Strings(mainDirs)
+	if mainDirs[0] == "." {
+		return "executable", ".", nil
+	}
+	return "executable", "./" + filepath.ToSlash(mainDirs[0]), nil
+}
+
+// WriteModuleConfig writes the configuration of a module
+func (c *Config) WriteModuleConfig(modConfig ModuleConfig, absolutePathAndName string) (err error) {
+	configStr, err := toml.Marshal(modConfig)
+	if err != nil {
+		return err
+	}
+	err = c.su.Fs.MkdirAll(absolutePathAndName)
+	if err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	filePath := filepath.Join(absolutePathAndName, c.Static.ModuleFileName)
+	return c.su.Fs.Write(filePath, configStr)
+}
+
+// CacheEntry contains the result of a successful script
+type CacheEntry struct {
+	Module string `json:"module"`
+	Script string `json:"script"`
+	Output string `json:"output"`
+}
+
+// CacheKey returns a hash of everything a script depends on: the script itself, the environment
+// variables declared in cache_env, and the files of the module and of the local modules it requires
+func (c *Config) CacheKey(graph ModuleGraph, module ModuleConfig, scriptName string, script Script) (key string, err error) {
+	h := sha256.New()
+	hashField(h, "script", []byte(scriptName))
+	hashField(h, "run", []byte(script.Run))
+	hashField(h, "dir", []byte(script.Dir))
+	hashField(h, "shell", []byte(script.Shell))
+	for _, name := range sortedKeys(script.Env) {
+		hashField(h, "script env", []byte(name+"="+script.Env[name]))
+	}
+	for _, name := range module.CacheEnv {
+		hashField(h, "env", []byte(name+"="+c.su.Os.Getenv(name)))
+	}
+	deps := graph.transitiveDeps(module.RelativePath)
+	sort.Strings(deps)
+	for _, relativePath := range append([]string{module.RelativePath}, deps...) {
+		if err := c.hashModuleFiles(h, relativePath); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashModuleFiles writes the path and the content of every file of a module to a hash,
+// files of nested modules are not included
+func (c *Config) hashModuleFiles(h hash.Hash, relativePath string) (err error) {
+	files, err := c.GetModuleFiles(relativePath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := c.su.Fs.Read(file)
+		if err != nil {
+			return err
+		}
+		relativeFile, err := filepath.Rel(c.Runtime.ROOT, file)
+		if err != nil {
+			return err
+		}
+		hashField(h, "file", []byte(filepath.ToSlash(relativeFile)))
+		hashField(h, "content", content)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map of strings in alphabetical order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hashField(h hash.Hash, label string, data []byte) {
+	_, _ = fmt.Fprintf(h, "%s %d\n", label, len(data))
+	_, _ = h.Write(data)
+}
+
+// cacheStores returns the local cache, followed by the remote cache if one is configured in work.toml
+func (c *Config) cacheStores() (stores []CacheStoreI, err error) {
+	stores = []CacheStoreI{NewFsCacheStore(c.su.Fs, filepath.Join(c.Runtime.ROOT, c.Static.CacheDir))}
+	rootConfig, err := c.LoadRootConfig()
+	if err != nil {
+		return nil, err
+	}
+	if rootConfig.Cache.Url != "" {
+		token := ""
+		if rootConfig.Cache.TokenEnv != "" {
+			token = c.su.Os.Getenv(rootConfig.Cache.TokenEnv)
+		}
+		stores = append(stores, NewHttpCacheStore(rootConfig.Cache.Url, token))
+	}
+	return stores, nil
+}
+
+// ReadCache returns the cache entry stored for a key, if any. The local cache is looked up first,
+// entries found in the remote cache are copied to the local one. Errors of the remote cache are
+// logged as warnings and handled as a cache miss.
+func (c *Config) ReadCache(key string) (entry CacheEntry, found bool, err error) {
+	stores, err := c.cacheStores()
+	if err != nil {
+		return entry, false, err
+	}
+	for i, store := range stores {
+		content, found, err := store.Get(key)
+		if err != nil && i == 0 {
+			return entry, false, err
+		} else if err != nil {
+			c.su.Logger.WarningLn("failed to read remote cache: " + err.Error())
+			continue
+		} else if !found {
+			continue
+		}
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return entry, false, fmt.Errorf("invalid cache entry %s: %w", key, err)
+		}
+		if i > 0 {
+			if err := stores[0].Put(key, content); err != nil {
+				return entry, false, err
+			}
+		}
+		return entry, true, nil
+	}
+	return entry, false, nil
+}
+
+// WriteCache stores a cache entry for a key in the local cache and in the remote one.
+// Errors of the remote cache are logged as warnings.
+func (c *Config) WriteCache(key string, entry CacheEntry) (err error) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	stores, err := c.cacheStores()
+	if err != nil {
+		return err
+	}
+	for i, store := range stores {
+		if err := store.Put(key, content); err != nil && i == 0 {
+			return err
+		} else if err != nil {
+			c.su.Logger.WarningLn("failed to write remote cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// CacheStoreI defines methods to read and write cache entries
+type CacheStoreI interface {
+	Get(key string) (content []byte, found bool, err error)
+	Put(key string, content []byte) error
+}
+
+// FsCacheStore implements CacheStoreI in a folder
+type FsCacheStore struct {
+	Fs  FsI
+	Dir string
+}
+
+var _ CacheStoreI = &FsCacheStore{}
+
+// NewFsCacheStore returns an instance of FsCacheStore
+func NewFsCacheStore(fs FsI, dir string) *FsCacheStore {
+	return &FsCacheStore{Fs: fs, Dir: dir}
+}
+
+// Get reads a cache entry from the folder
+func (s *FsCacheStore) Get(key string) (content []byte, found bool, err error) {
+	path := filepath.Join(s.Dir, key+".json")
+	if !s.Fs.Exists(path) {
+		return nil, false, nil
+	}
+	content, err = s.Fs.Read(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// Put writes a cache entry to the folder
+func (s *FsCacheStore) Put(key string, content []byte) (err error) {
+	if err := s.Fs.MkdirAll(s.Dir); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	return s.Fs.Write(filepath.Join(s.Dir, key+".json"), content)
+}
+
+// HttpCacheStore implements CacheStoreI over HTTP, with GET <url>/<key> and PUT <url>/<key>
+type HttpCacheStore struct {
+	Url    string
+	Token  string // sent as a bearer token if not empty
+	Client *http.Client
+}
+
+var _ CacheStoreI = &HttpCacheStore{}
+
+// NewHttpCacheStore returns an instance of HttpCacheStore
+func NewHttpCacheStore(url, token string) *HttpCacheStore {
+	return &HttpCacheStore{
+		Url:    strings.TrimSuffix(url, "/"),
+		Token:  token,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Get downloads a cache entry, a 404 is a cache miss
+func (s *HttpCacheStore) Get(key string) (content []byte, found bool, err error) {
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("GET %s/%s returned %s", s.Url, key, resp.Status)
+	}
+	content, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// Put uploads a cache entry
+func (s *HttpCacheStore) Put(key string, content []byte) (err error) {
+	resp, err := s.do(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT %s/%s returned %s", s.Url, key, resp.Status)
+	}
+	return nil
+}
+
+func (s *HttpCacheStore) do(method, key string, content []byte) (resp *http.Response, err error) {
+	req, err := http.NewRequest(method, s.Url+"/"+key, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return s.Client.Do(req)
+}
+
+// Commands contains the actual CLI commands
+type Commands struct {
+	SystemUtils *SystemUtils
+	Config      *Config
+}
+
+// NewCommands returns an instance of Commands
+func NewCommands(su *SystemUtils, cfg *Config) *Commands {
+	return &Commands{
+		SystemUtils: su,
+		Config:      cfg,
+	}
+}
+
+////////////////////////////////////////
+// CLI COMMANDS
+////////////////////////////////////////
+
+// Init implements `gorepo init`
+func (cmd *Commands) Init(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); exists {
+		return errors.New("monorepo already exists at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
+
+	importModules := c.Bool("import")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag import:       " + strconv.FormatBool(importModules))
+	}
+
+	rootConfig := RootConfig{
+		Name:     c.Args().Get(0),
+		Version:  "0.1.0",
+		Strategy: "workspace",
+		Vendor:   true,
+	}
+
+	// ask name
+	if rootConfig.Name == "" {
+		defaultName := filepath.Base(cmd.Config.Runtime.ROOT)
+		nameResponse, err := cmd.SystemUtils.Os.AskString("What is the monorepo name?", "", defaultName, cmd.SystemUtils.Logger)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		rootConfig.Name = nameResponse
+	}
+
+	// ask strategy
+	cmd.SystemUtils.Logger.InfoLn("Using go workspace strategy by default (no other option for now)")
+
+	// ask if should vendor
+	if vendorResponse, err := cmd.SystemUtils.Os.AskBool(
+		"Do you want to vendor dependencies?", "y/n", "y", cmd.SystemUtils.Logger); err == nil {
+		rootConfig.Vendor = vendorResponse
+	} else {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	// find existing modules and preview them before writing anything
+	var imported []ModuleConfig
+	if importModules {
+		var err error
+		if imported, err = cmd.findModulesToImport(); err != nil {
+			return err
+		}
+		if len(imported) == 0 {
+			cmd.SystemUtils.Logger.InfoLn("no go.mod found, nothing to import")
+		} else {
+			cmd.SystemUtils.Logger.InfoLn("the following modules will be imported:")
+			for _, module := range imported {
+				line := "  " + module.RelativePath + " (" + module.Type
+				if module.Main != "" {
+					line += ", main: " + module.Main
+				}
+				cmd.SystemUtils.Logger.DefaultLn(line + ")")
+			}
+			confirmed, err := cmd.SystemUtils.Os.AskBool("Do you want to import these modules?", "y/n", "y", cmd.SystemUtils.Logger)
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			if !confirmed {
+				cmd.SystemUtils.Logger.InfoLn("monorepo not initialized, nothing was written")
+				return nil
+			}
+		}
+	}
+
+	// handle go workspace
+	if rootConfig.Strategy == "workspace" {
+		if exists := cmd.Config.GoWorkspaceExists(); !exists {
+			if verbose {
+				cmd.SystemUtils.Logger.VerboseLn("go workspace does not exist yet, running 'go work init'")
+			}
+			_, err := cmd.SystemUtils.Exec.GoCommand(c.Context, cmd.Config.Runtime.ROOT, ExecOptions{}, "work", "init")
+			if err != nil {
+				return err
+			}
+		} else {
+			if verbose {
+				cmd.SystemUtils.Logger.VerboseLn("go workspace already exists, no need to create one")
+			}
+			// todo: handle vendoring
+		}
+	} else if rootConfig.Strategy == "rewrite" {
+		return errors.New("rewrite strategy unsupported yet")
+	} else {
+		return errors.New("invalid strategy '" + rootConfig.Strategy + "'")
+	}
+
+	if err := cmd.Config.WriteRootConfig(rootConfig); err != nil {
+		return err
+	} else {
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("created monorepo configuration 'work.toml' at root")
+		}
+	}
+
+	if len(imported) > 0 {
+		if err := cmd.importModules(c.Context, imported, rootConfig.Strategy, verbose); err != nil {
+			return err
+		}
+	}
+
+	cmd.SystemUtils.Logger.SuccessLn("monorepo successfully initialized at " + cmd.Config.Runtime.ROOT)
+
+	return nil
+}
+
+// findModulesToImport returns the folders with a go.mod, with the type and main inferred from their go files
+func (cmd *Commands) findModulesToImport() (modules []ModuleConfig, err error) {
+	relativePaths, err := cmd.Config.GetGoModFolders()
+	if err != nil {
+		return nil, err
+	}
+	for _, relativePath := range relativePaths {
+		moduleType, main, err := cmd.Config.InferModuleType(relativePath)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, ModuleConfig{
+			Name:         filepath.Base(relativePath),
+			RelativePath: relativePath,
+			Template:     "@default",
+			Type:         moduleType,
+			Main:         main,
+			Scripts:      map[string]Script{},
+		})
+	}
+	return modules, nil
+}
+
+// importModules creates a module.toml for the modules that do not have one, and adds them all to the workspace at once
+func (cmd *Commands) importModules(ctx context.Context, modules []ModuleConfig, strategy string, verbose bool) error {
+	var relativePaths []string
+	for _, module := range modules {
+		absolutePath := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
+		relativePaths = append(relativePaths, module.RelativePath)
+		if cmd.SystemUtils.Fs.Exists(filepath.Join(absolutePath, cmd.Config.Static.ModuleFileName)) {
+			if verbose {
+				cmd.SystemUtils.Logger.VerboseLn(module.RelativePath + " already has a " + cmd.Config.Static.ModuleFileName)
+			}
+			continue
+		}
+		if err := cmd.Config.WriteModuleConfig(module, absolutePath); err != nil {
+			return err
+		}
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("created " + filepath.Join(module.RelativePath, cmd.Config.Static.ModuleFileName))
+		}
+	}
+	if strategy == "workspace" {
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("running 'go work use " + strings.Join(relativePaths, " ") + "'")
+		}
+		if _, err := cmd.SystemUtils.Exec.GoCommand(ctx, cmd.Config.Runtime.ROOT, ExecOptions{}, append([]string{"work", "use"}, relativePaths...)...); err != nil {
+			return err
+		}
+	}
+	cmd.SystemUtils.Logger.SuccessLn(strconv.Itoa(len(modules)) + " module(s) imported")
+	return nil
+}
+
+func (cmd *Commands) Add(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+	relativePathAndNameInput := c.Args().Get(0)
+	cmd.SystemUtils.Logger.VerboseLn("relativePathAndNameInput: " + relativePathAndNameInput)
+	if relativePathAndNameInput == "" {
+		return errors.New("error: no name provided")
+	}
+	name := filepath.Base(relativePathAndNameInput)
+	cmd.SystemUtils.Logger.VerboseLn("name: " + name)
+	if modules, err := cmd.Config.GetModules([]string{"all"}, []string{}, false); err != nil {
+		return err
+	} else {
+		for _, module := range modules {
+			if module.Name == name {
+				return errors.New("module with name " + name + " already exists at " + module.RelativePath)
+			}
+		}
+	}
+	newModule := ModuleConfig{
+		Name:         name,
+		RelativePath: relativePathAndNameInput,
+		Template:     "@default",
+		Type:         "executable",
+		Main:         "",
+		Priority:     0,
+		Scripts:      map[string]Script{},
+	}
+	absolutePath := filepath.Join(cmd.Config.Runtime.ROOT, relativePathAndNameInput)
+	if err := cmd.Config.WriteModuleConfig(newModule, absolutePath); err != nil {
+		return err
+	}
+	if _, err := cmd.SystemUtils.Exec.GoCommand(c.Context, absolutePath, ExecOptions{}, "mod", "init", name); err != nil {
+		return err
+	}
+	if config, err := cmd.Config.LoadRootConfig(); err != nil {
+		return err
+	} else if config.Strategy == "workspace" {
+		if _, err := cmd.SystemUtils.Exec.GoCommand(c.Context, cmd.Config.Runtime.ROOT, ExecOptions{}, "work", "use", relativePathAndNameInput); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove implements `gorepo remove`
+func (cmd *Commands) Remove(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
+
+	moduleInput := c.Args().Get(0)
+	if moduleInput == "" {
+		return errors.New("error: no module provided, usage: gorepo remove [module_name]")
+	}
+
+	force := c.Bool("force")
+	archive := c.Bool("archive")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag force:        " + strconv.FormatBool(force))
+		cmd.SystemUtils.Logger.VerboseLn("value for flag archive:      " + strconv.FormatBool(archive))
+	}
+
+	graph, err := cmd.Config.GetModuleGraph()
+	if err != nil {
+		return err
+	}
+	module, err := graph.find(moduleInput)
+	if err != nil {
+		return err
+	}
+
+	// refuse to break the modules that still need it
+	var dependents []string
+	for _, relativePath := range graph.dependents(module.RelativePath) {
+		dependents = append(dependents, graph.name(relativePath))
+	}
+	var nested []string
+	for _, other := range graph.Modules {
+		if strings.HasPrefix(other.RelativePath, module.RelativePath+string(filepath.Separator)) {
+			nested = append(nested, other.Name)
+		}
+	}
+	if len(dependents) > 0 && !force {
+		return errors.New("module " + module.Name + " is still required by: " + strings.Join(dependents, ", ") + " (use --force to remove it anyway)")
+	} else if len(nested) > 0 && !force {
+		return errors.New("module " + module.Name + " contains other modules: " + strings.Join(nested, ", ") + " (use --force to remove it anyway)")
+	} else if len(dependents) > 0 {
+		cmd.SystemUtils.Logger.WarningLn("module " + module.Name + " is still required by: " + strings.Join(dependents, ", "))
+	}
+
+	absolutePath := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
+	if !archive {
+		confirmed, err := cmd.SystemUtils.Os.AskBool("Do you want to delete the folder "+module.RelativePath+"?", "y/n", "n", cmd.SystemUtils.Logger)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if !confirmed {
+			cmd.SystemUtils.Logger.InfoLn("module " + module.Name + " was not removed")
+			return nil
+		}
+	}
+
+	// drop it from the workspace
+	if config, err := cmd.Config.LoadRootConfig(); err != nil {
+		return err
+	} else if config.Strategy == "workspace" && cmd.Config.GoWorkspaceExists() {
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("running 'go work edit -dropuse=" + module.RelativePath + "'")
+		}
+		if _, err := cmd.SystemUtils.Exec.GoCommand(c.Context, cmd.Config.Runtime.ROOT, ExecOptions{}, "work", "edit", "-dropuse="+module.RelativePath); err != nil {
+			return err
+		}
+	}
+
+	// delete or archive the folder
+	if archive {
+		archivePath := filepath.Join(cmd.Config.Runtime.ROOT, cmd.Config.Static.ArchiveDir,
+			module.Name+"-"+time.Now().Format("20060102150405"))
+		if err := cmd.SystemUtils.Fs.MkdirAll(filepath.Dir(archivePath)); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+		if err := cmd.SystemUtils.Fs.Rename(absolutePath, archivePath); err != nil {
+			return err
+		}
+		cmd.SystemUtils.Logger.SuccessLn("module " + module.Name + " removed and archived at " + archivePath)
+		return nil
+	}
+	if err := cmd.SystemUtils.Fs.RemoveAll(absolutePath); err != nil {
+		return err
+	}
+	cmd.SystemUtils.Logger.SuccessLn("module " + module.Name + " removed")
+	return nil
+}
+
+// Move implements `gorepo mv`
+func (cmd *Commands) Move(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
+
+	moduleInput := c.Args().Get(0)
+	newRelativePath := filepath.Clean(c.Args().Get(1))
+	if moduleInput == "" || c.Args().Get(1) == "" {
+		return errors.New("error: missing arguments, usage: gorepo mv [module_name] [new/relative/path]")
+	}
+	if filepath.IsAbs(newRelativePath) || strings.HasPrefix(newRelativePath, "..") {
+		return errors.New("error: the new path must be relative to the root of the monorepo")
+	}
+
+	graph, err := cmd.Config.GetModuleGraph()
+	if err != nil {
+		return err
+	}
+	module, err := graph.find(moduleInput)
+	if err != nil {
+		return err
+	}
+	oldRelativePath := module.RelativePath
+	newName := filepath.Base(newRelativePath)
+	for _, other := range graph.Modules {
+		if other.Name == newName && other.RelativePath != oldRelativePath {
+			return errors.New("module with name " + newName + " already exists at " + other.RelativePath)
+		}
+	}
+	newAbsolutePath := filepath.Join(cmd.Config.Runtime.ROOT, newRelativePath)
+	if cmd.SystemUtils.Fs.Exists(newAbsolutePath) {
+		return errors.New("error: " + newRelativePath + " already exists")
+	}
+
+	oldModulePath := graph.ModulePaths[oldRelativePath]
+	newModulePath := c.String("module-path")
+	if newModulePath == "" {
+		newModulePath = oldModulePath
+	}
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("moving " + oldRelativePath + " to " + newRelativePath)
+		cmd.SystemUtils.Logger.VerboseLn("module path " + oldModulePath + " -> " + newModulePath)
+	}
+
+	// move the folder
+	if err := cmd.SystemUtils.Fs.MkdirAll(filepath.Dir(newAbsolutePath)); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	if err := cmd.SystemUtils.Fs.Rename(filepath.Join(cmd.Config.Runtime.ROOT, oldRelativePath), newAbsolutePath); err != nil {
+		return err
+	}
+
+	// modules nested in the moved folder move with it
+	movedPaths := map[string]string{}
+	for _, other := range graph.Modules {
+		if other.RelativePath == oldRelativePath {
+			movedPaths[other.RelativePath] = newRelativePath
+		} else if strings.HasPrefix(other.RelativePath, oldRelativePath+string(filepath.Separator)) {
+			movedPaths[other.RelativePath] = newRelativePath + strings.TrimPrefix(other.RelativePath, oldRelativePath)
+		}
+	}
+
+	// rewrite go.mod and imports in every module
+	if newModulePath != oldModulePath && oldModulePath != "" {
+		for _, other := range graph.Modules {
+			relativePath := other.RelativePath
+			if moved, ok := movedPaths[relativePath]; ok {
+				relativePath = moved
+			}
+			if err := cmd.rewriteModulePath(relativePath, oldModulePath, newModulePath, verbose); err != nil {
+				return err
+			}
+		}
+	}
+
+	// relative replace directives follow the moved folder, and start from it in its modules
+	for _, other := range graph.Modules {
+		relativePath, _ := movePath(other.RelativePath, oldRelativePath, newRelativePath)
+		goModPath := filepath.Join(cmd.Config.Runtime.ROOT, relativePath, "go.mod")
+		if !cmd.SystemUtils.Fs.Exists(goModPath) {
+			continue
+		}
+		content, err := cmd.SystemUtils.Fs.Read(goModPath)
+		if err != nil {
+			return err
+		}
+		rewritten := replaceRelativeReplaces(content, other.RelativePath, relativePath, oldRelativePath, newRelativePath)
+		if bytes.Equal(content, rewritten) {
+			continue
+		}
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("rewriting " + goModPath)
+		}
+		if err := cmd.SystemUtils.Fs.Write(goModPath, rewritten); err != nil {
+			return err
+		}
+	}
+
+	// update the workspace
+	if config, err := cmd.Config.LoadRootConfig(); err != nil {
+		return err
+	} else if config.Strategy == "workspace" && cmd.Config.GoWorkspaceExists() {
+		args := []string{"work", "edit"}
+		for _, other := range graph.Modules {
+			if moved, ok := movedPaths[other.RelativePath]; ok {
+				args = append(args, "-dropuse="+other.RelativePath, "-use="+moved)
+			}
+		}
+		if _, err := cmd.SystemUtils.Exec.GoCommand(c.Context, cmd.Config.Runtime.ROOT, ExecOptions{}, args...); err != nil {
+			return err
+		}
+	}
+
+	cmd.SystemUtils.Logger.SuccessLn("module " + module.Name + " moved to " + newRelativePath)
+	return nil
+}
+
+// rewriteModulePath replaces a module path in the go.mod and in the imports of the go files of a module
+func (cmd *Commands) rewriteModulePath(relativePath, oldModulePath, newModulePath string, verbose bool) error {
+	files, err := cmd.Config.GetModuleFiles(relativePath)
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(cmd.Config.Runtime.ROOT, relativePath)
+	for _, file := range files {
+		isGoMod := file == filepath.Join(root, "go.mod")
+		if !isGoMod && (filepath.Ext(file) != ".go" || strings.HasPrefix(file, filepath.Join(root, "vendor")+string(filepath.Separator))) {
+			continue
+		}
+		content, err := cmd.SystemUtils.Fs.Read(file)
+		if err != nil {
+			return err
+		}
+		var rewritten []byte
+		if isGoMod {
+			rewritten = replaceGoModPath(content, oldModulePath, newModulePath)
+		} else if rewritten, err = replaceImportPath(content, oldModulePath, newModulePath); err != nil {
+			cmd.SystemUtils.Logger.WarningLn("could not parse " + file + ", imports not rewritten: " + err.Error())
+			continue
+		}
+		if bytes.Equal(content, rewritten) {
+			continue
+		}
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("rewriting " + file)
+		}
+		if err := cmd.SystemUtils.Fs.Write(file, rewritten); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceGoModPath replaces a module path, and the paths below it, in the directives of a go.mod
+func replaceGoModPath(content []byte, oldPath, newPath string) []byte {
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		code, comment := line, ""
+		if j := strings.Index(line, "//"); j >= 0 {
+			code, comment = line[:j], line[j:]
+		}
+		var rewritten strings.Builder
+		for {
+			j := strings.Index(code, oldPath)
+			if j < 0 {
+				rewritten.WriteString(code)
+				break
+			}
+			end := j + len(oldPath)
+			startsToken := j == 0 || strings.ContainsAny(code[j-1:j], " \t\"`")
+			endsToken := end == len(code) || strings.ContainsAny(code[end:end+1], " \t\"`/")
+			rewritten.WriteString(code[:j])
+			if startsToken && endsToken {
+				rewritten.WriteString(newPath)
+			} else {
+				rewritten.WriteString(oldPath)
+			}
+			code = code[end:]
+		}
+		lines[i] = rewritten.String() + comment
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// replaceRelativeReplaces recomputes the relative paths of the replace directives of a go.mod that moved
+// from oldDir to newDir, when a folder moved from oldPath to newPath. Paths are relative to the root.
+func replaceRelativeReplaces(content []byte, oldDir, newDir, oldPath, newPath string) []byte {
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		code := line
+		if j := strings.Index(line, "//"); j >= 0 {
+			code = line[:j]
+		}
+		// only replace directives have an arrow, the replacement starts with ./ or ../ when it is a directory
+		arrow := strings.Index(code, "=>")
+		if arrow < 0 {
+			continue
+		}
+		fields := strings.Fields(code[arrow+2:])
+		if len(fields) == 0 {
+			continue
+		}
+		target := filepath.FromSlash(fields[0])
+		if target != "." && target != ".." && !strings.HasPrefix(fields[0], "./") && !strings.HasPrefix(fields[0], "../") {
+			continue
+		}
+		moved, ok := movePath(filepath.Join(oldDir, target), oldPath, newPath)
+		if !ok && oldDir == newDir {
+			continue
+		}
+		relative, err := filepath.Rel(newDir, moved)
+		if err != nil {
+			continue
+		}
+		relative = filepath.ToSlash(relative)
+		if relative != "." && relative != ".." && !strings.HasPrefix(relative, "../") {
+			relative = "./" + relative
+		}
+		start := arrow + 2 + strings.Index(code[arrow+2:], fields[0])
+		lines[i] = line[:start] + relative + line[start+len(fields[0]):]
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// replaceImportPath replaces an import path, and the paths below it, in the imports of a go file
+func replaceImportPath(content []byte, oldPath, newPath string) (rewritten []byte, err error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	last := 0
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || (path != oldPath && !strings.HasPrefix(path, oldPath+"/")) {
+			continue
+		}
+		start, end := fset.Position(spec.Path.Pos()).Offset, fset.Position(spec.Path.End()).Offset
+		rewritten = append(rewritten, content[last:start]...)
+		rewritten = append(rewritten, strconv.Quote(newPath+strings.TrimPrefix(path, oldPath))...)
+		last = end
+	}
+	return append(rewritten, content[last:]...), nil
+}
+
+// healthIssue is a problem found by `gorepo check`
+type healthIssue struct {
+	Description string
+	Fix         func(ctx context.Context) error // nil if the issue can not be fixed safely
+}
+
+// Check implements `gorepo check`
+func (cmd *Commands) Check(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
+
+	fix := c.Bool("fix")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag fix:          " + strconv.FormatBool(fix))
+	}
+
+	issues, err := cmd.findHealthIssues(verbose)
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		cmd.SystemUtils.Logger.SuccessLn("no issue found")
+		return nil
+	}
+
+	remaining := 0
+	for _, issue := range issues {
+		if fix && issue.Fix != nil {
+			if err := issue.Fix(c.Context); err != nil {
+				return err
+			}
+			cmd.SystemUtils.Logger.SuccessLn("fixed: " + issue.Description)
+		} else if issue.Fix != nil {
+			cmd.SystemUtils.Logger.WarningLn(issue.Description + " (fixable with --fix)")
+			remaining++
+		} else {
+			cmd.SystemUtils.Logger.WarningLn(issue.Description)
+			remaining++
+		}
+	}
+	if remaining > 0 {
+		// the fixes that were applied are kept, they do not depend on the remaining issues
+		return &keepChangesError{errors.New(strconv.Itoa(remaining) + " issue(s) found")}
+	}
+	return nil
+}
+
+// findHealthIssues checks the consistency between go.mod files, module.toml files and go.work
+func (cmd *Commands) findHealthIssues(verbose bool) (issues []healthIssue, err error) {
+	root := cmd.Config.Runtime.ROOT
+	modules, err := cmd.Config.GetModules([]string{"all"}, []string{}, false)
+	if err != nil {
+		return nil, err
+	}
+	goModFolders, err := cmd.Config.GetGoModFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	// go.mod and module.toml go together
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("checking that every folder with a go.mod has a module.toml and vice versa")
+	}
+	for _, relativePath := range goModFolders {
+		if !cmd.SystemUtils.Fs.Exists(filepath.Join(root, relativePath, cmd.Config.Static.ModuleFileName)) {
+			issues = append(issues, healthIssue{
+				Description: relativePath + " has a go.mod but no " + cmd.Config.Static.ModuleFileName,
+				Fix: func(ctx context.Context) error {
+					moduleType, main, err := cmd.Config.InferModuleType(relativePath)
+					if err != nil {
+						return err
+					}
+					return cmd.Config.WriteModuleConfig(ModuleConfig{
+						Template: "@default",
+						Type:     moduleType,
+						Main:     main,
+						Scripts:  map[string]Script{},
+					}, filepath.Join(root, relativePath))
+				},
+			})
+		}
+	}
+	for _, module := range modules {
+		if !contains(goModFolders, module.RelativePath) {
+			issues = append(issues, healthIssue{
+				Description: module.RelativePath + " has a " + cmd.Config.Static.ModuleFileName + " but no go.mod",
+			})
+		}
+	}
+
+	// module names are unique
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("checking that module names are unique")
+	}
+	paths := map[string][]string{}
+	var names []string
+	for _, module := range modules {
+		if _, ok := paths[module.Name]; !ok {
+			names = append(names, module.Name)
+		}
+		paths[module.Name] = append(paths[module.Name], module.RelativePath)
+	}
+	for _, name := range names {
+		if len(paths[name]) > 1 {
+			issues = append(issues, healthIssue{
+				Description: "several modules are named " + name + ": " + strings.Join(paths[name], ", "),
+			})
+		}
+	}
+
+	// go.work lists every module, and only them
+	rootConfig, err := cmd.Config.LoadRootConfig()
+	if err != nil {
+		return nil, err
+	}
+	if rootConfig.Strategy != "workspace" {
+		return issues, nil
+	}
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("checking that go.work lists every module and only existing modules")
+	}
+	var uses []string
+	if !cmd.Config.GoWorkspaceExists() {
+		issues = append(issues, healthIssue{
+			Description: "go.work is missing",
+			Fix: func(ctx context.Context) error {
+				_, err := cmd.SystemUtils.Exec.GoCommand(ctx, root, ExecOptions{}, "work", "init")
+				return err
+			},
+		})
+	} else if uses, err = cmd.Config.GetWorkspaceUses(); err != nil {
+		return nil, err
+	}
+	for _, use := range uses {
+		if !contains(goModFolders, use) {
+			issues = append(issues, healthIssue{
+				Description: "go.work uses " + use + " which does not contain a go.mod",
+				Fix: func(ctx context.Context) error {
+					_, err := cmd.SystemUtils.Exec.GoCommand(ctx, root, ExecOptions{}, "work", "edit", "-dropuse="+use)
+					return err
+				},
+			})
+		}
+	}
+	for _, relativePath := range goModFolders {
+		if !contains(uses, relativePath) {
+			issues = append(issues, healthIssue{
+				Description: relativePath + " is not in go.work",
+				Fix: func(ctx context.Context) error {
+					_, err := cmd.SystemUtils.Exec.GoCommand(ctx, root, ExecOptions{}, "work", "use", relativePath)
+					return err
+				},
+			})
+		}
+	}
+	return issues, nil
+}
+
+// journalFile is the content of the journal of the last command, kept for gorepo undo
+type journalFile struct {
+	Command string         `json:"command"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// keepChangesError is returned by a command that fails after making changes that are complete
+// on their own, so that transaction keeps them in the journal instead of rolling them back
+type keepChangesError struct {
+	err error
+}
+
+func (e *keepChangesError) Error() string {
+	return e.err.Error()
+}
+
+func (e *keepChangesError) Unwrap() error {
+	return e.err
+}
+
+// transaction wraps a command that changes the monorepo, its changes are rolled back if it fails,
+// or kept in the journal for gorepo undo if it succeeds. With --dry-run nothing is changed, so the
+// command runs without journal.
+func (cmd *Commands) transaction(name string, action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if c.Bool("dry-run") {
+			return action(c)
+		}
+		fs, x := cmd.SystemUtils.Fs, cmd.SystemUtils.Exec
+		journalDir := filepath.Join(cmd.Config.Runtime.ROOT, cmd.Config.Static.JournalDir)
+		journal := NewJournal(fs, x, cmd.Config.Runtime.ROOT, journalDir)
+		cmd.SystemUtils.Fs, cmd.SystemUtils.Exec = journal, journal
+		err := action(c)
+		cmd.SystemUtils.Fs, cmd.SystemUtils.Exec = fs, x
+		var keep *keepChangesError
+		if err != nil && !errors.As(err, &keep) {
+			if len(journal.Changes()) > 0 {
+				cmd.SystemUtils.Logger.WarningLn("rolling back the changes made by " + name)
+				if rollbackErr := journal.Rollback(); rollbackErr != nil {
+					return errors.Join(err, rollbackErr)
+				}
+			}
+			return err
+		}
+		changes := journal.Changes()
+		if len(changes) == 0 {
+			return err
+		}
+		// the trash of the previous command cannot be restored anymore
+		journalPath := filepath.Join(journalDir, "journal.json")
+		if content, err := fs.Read(journalPath); err == nil {
+			var previous journalFile
+			if err := json.Unmarshal(content, &previous); err == nil {
+				for _, entry := range previous.Entries {
+					if entry.Op == "remove" {
+						_ = fs.RemoveAll(entry.NewPath)
+					}
+				}
+			}
+		}
+		content, marshalErr := json.Marshal(journalFile{
+			Command: strings.TrimSpace(name + " " + strings.Join(c.Args().Slice(), " ")),
+			Entries: changes,
+		})
+		if marshalErr != nil {
+			return marshalErr
+		}
+		if mkdirErr := fs.MkdirAll(journalDir); mkdirErr != nil {
+			return fmt.Errorf("failed to create directories: %w", mkdirErr)
+		}
+		if writeErr := fs.Write(journalPath, content); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
 }
 
-// WriteModuleConfig writes the configuration of a module
-func (c *Config) WriteModuleConfig(modConfig ModuleConfig, absolutePathAndName string) (err error) {
-	fmt.Println("absolutePathAndName: " + absolutePathAndName)
-	configStr, err := toml.Marshal(modConfig)
+// Undo implements `gorepo undo`
+func (cmd *Commands) Undo(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
+
+	journalDir := filepath.Join(cmd.Config.Runtime.ROOT, cmd.Config.Static.JournalDir)
+	journalPath := filepath.Join(journalDir, "journal.json")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("reading journal at " + journalPath)
+	}
+	if !cmd.SystemUtils.Fs.Exists(journalPath) {
+		return errors.New("nothing to undo")
+	}
+	content, err := cmd.SystemUtils.Fs.Read(journalPath)
 	if err != nil {
 		return err
 	}
-	// todo: extract that as a side effect
-	err = os.MkdirAll(absolutePathAndName, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create directories: %w", err)
+	var journal journalFile
+	if err := json.Unmarshal(content, &journal); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", journalPath, err)
 	}
-	filePath := filepath.Join(absolutePathAndName, c.Static.ModuleFileName)
-	fmt.Println("filePath: " + filePath)
-	return c.su.Fs.Write(filePath, configStr)
-}
 
-// Commands contains the actual CLI commands
-type Commands struct {
-	SystemUtils *SystemUtils
-	Config      *Config
+	cmd.SystemUtils.Logger.InfoLn("undoing 'gorepo " + journal.Command + "':")
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		cmd.SystemUtils.Logger.DefaultLn("  " + describeJournalEntry(journal.Entries[i]))
+	}
+	confirmed, err := cmd.SystemUtils.Os.AskBool("Do you want to revert these changes?", "y/n", "n", cmd.SystemUtils.Logger)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if !confirmed {
+		cmd.SystemUtils.Logger.InfoLn("nothing was reverted")
+		return nil
+	}
+	if err := revertJournalEntries(cmd.SystemUtils.Fs, journal.Entries); err != nil {
+		return err
+	}
+	if err := cmd.SystemUtils.Fs.RemoveAll(journalDir); err != nil {
+		return err
+	}
+	cmd.SystemUtils.Logger.SuccessLn("'gorepo " + journal.Command + "' was reverted")
+	return nil
 }
 
-// NewCommands returns an instance of Commands
-func NewCommands(su *SystemUtils, cfg *Config) *Commands {
-	return &Commands{
-		SystemUtils: su,
-		Config:      cfg,
+// Graph implements `gorepo graph`
+func (cmd *Commands) Graph(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
 	}
-}
 
-////////////////////////////////////////
-// CLI COMMANDS
-////////////////////////////////////////
+	verbose := c.Bool("verbose")
 
-// Init implements `gorepo init`
-func (cmd *Commands) Init(c *cli.Context) error {
-	if exists := cmd.Config.RootConfigExists(); exists {
-		return errors.New("monorepo already exists at " + cmd.Config.Runtime.ROOT)
+	format := c.String("format")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag format:       " + format)
 	}
 
-	verbose := c.Bool("verbose")
+	focus := c.String("focus")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag focus:        " + focus)
+	}
 
-	rootConfig := RootConfig{
-		Name:     c.Args().Get(0),
-		Version:  "0.1.0",
-		Strategy: "workspace",
-		Vendor:   true,
+	graph, err := cmd.Config.GetModuleGraph()
+	if err != nil {
+		return err
 	}
 
-	// ask name
-	if rootConfig.Name == "" {
-		defaultName := filepath.Base(cmd.Config.Runtime.ROOT)
-		nameResponse, err := cmd.SystemUtils.Os.AskString("What is the monorepo name?", "", defaultName, cmd.SystemUtils.Logger)
+	// keep the focused module, what it depends on and what depends on it
+	included := map[string]bool{}
+	for _, module := range graph.Modules {
+		included[module.RelativePath] = focus == ""
+	}
+	if focus != "" {
+		module, err := graph.find(focus)
 		if err != nil {
-			return fmt.Errorf("failed to read input: %w", err)
+			return err
+		}
+		included[module.RelativePath] = true
+		for _, relativePath := range append(graph.transitiveDeps(module.RelativePath), graph.transitiveDependents(module.RelativePath)...) {
+			included[relativePath] = true
 		}
-		rootConfig.Name = nameResponse
 	}
-
-	// ask strategy
-	cmd.SystemUtils.Logger.InfoLn("Using go workspace strategy by default (no other option for now)")
-
-	// ask if should vendor
-	if vendorResponse, err := cmd.SystemUtils.Os.AskBool(
-		"Do you want to vendor dependencies?", "y/n", "y", cmd.SystemUtils.Logger); err == nil {
-		rootConfig.Vendor = vendorResponse
-	} else {
-		return fmt.Errorf("failed to read input: %w", err)
+	var modules []ModuleConfig
+	for _, module := range graph.Modules {
+		if included[module.RelativePath] {
+			modules = append(modules, module)
+		}
+	}
+	deps := map[string][]string{}
+	for _, module := range modules {
+		for _, dep := range graph.Deps[module.RelativePath] {
+			if included[dep] {
+				deps[module.RelativePath] = append(deps[module.RelativePath], dep)
+			}
+		}
+		sort.Slice(deps[module.RelativePath], func(i, j int) bool {
+			return graph.name(deps[module.RelativePath][i]) < graph.name(deps[module.RelativePath][j])
+		})
 	}
 
-	// handle go workspace
-	if rootConfig.Strategy == "workspace" {
-		if exists := cmd.Config.GoWorkspaceExists(); !exists {
-			if verbose {
-				cmd.SystemUtils.Logger.VerboseLn("go workspace does not exist yet, running 'go work init'")
+	var lines []string
+	switch format {
+	case "tree":
+		lines = graphTree(graph, modules, deps)
+	case "dot":
+		lines = append(lines, "digraph modules {")
+		for _, module := range modules {
+			if len(deps[module.RelativePath]) == 0 {
+				lines = append(lines, "  "+strconv.Quote(module.Name)+";")
 			}
-			err := cmd.SystemUtils.Exec.GoCommand(cmd.Config.Runtime.ROOT, "work", "init")
-			if err != nil {
-				return err
+			for _, dep := range deps[module.RelativePath] {
+				lines = append(lines, "  "+strconv.Quote(module.Name)+" -> "+strconv.Quote(graph.name(dep))+";")
 			}
-		} else {
-			if verbose {
-				cmd.SystemUtils.Logger.VerboseLn("go workspace already exists, no need to create one")
+		}
+		lines = append(lines, "}")
+	case "mermaid":
+		ids := map[string]string{}
+		lines = append(lines, "graph TD")
+		for i, module := range modules {
+			ids[module.RelativePath] = "m" + strconv.Itoa(i)
+			lines = append(lines, "  "+ids[module.RelativePath]+"[\""+module.Name+"\"]")
+		}
+		for _, module := range modules {
+			for _, dep := range deps[module.RelativePath] {
+				lines = append(lines, "  "+ids[module.RelativePath]+" --> "+ids[dep])
 			}
-			// todo: handle vendoring
 		}
-	} else if rootConfig.Strategy == "rewrite" {
-		return errors.New("rewrite strategy unsupported yet")
-	} else {
-		return errors.New("invalid strategy '" + rootConfig.Strategy + "'")
+	case "json":
+		type jsonModule struct {
+			Name         string   `json:"name"`
+			Path         string   `json:"path"`
+			ModulePath   string   `json:"module_path"`
+			Dependencies []string `json:"dependencies"`
+		}
+		jsonModules := []jsonModule{}
+		for _, module := range modules {
+			dependencies := []string{}
+			for _, dep := range deps[module.RelativePath] {
+				dependencies = append(dependencies, filepath.ToSlash(dep))
+			}
+			jsonModules = append(jsonModules, jsonModule{
+				Name:         module.Name,
+				Path:         filepath.ToSlash(module.RelativePath),
+				ModulePath:   graph.ModulePaths[module.RelativePath],
+				Dependencies: dependencies,
+			})
+		}
+		content, err := json.MarshalIndent(map[string][]jsonModule{"modules": jsonModules}, "", "  ")
+		if err != nil {
+			return err
+		}
+		lines = strings.Split(string(content), "\n")
+	default:
+		return errors.New("invalid format '" + format + "', use tree, dot, mermaid or json")
+	}
+	for _, line := range lines {
+		cmd.SystemUtils.Logger.DefaultLn(line)
+	}
+	return nil
+}
+
+// graphTree renders the modules as trees, starting from the modules nothing depends on.
+// Modules already expanded above are marked with (*), cycles with (cycle).
+func graphTree(graph ModuleGraph, modules []ModuleConfig, deps map[string][]string) (lines []string) {
+	hasDependents := map[string]bool{}
+	for _, module := range modules {
+		for _, dep := range deps[module.RelativePath] {
+			hasDependents[dep] = true
+		}
+	}
+	expanded := map[string]bool{}
+	onPath := map[string]bool{}
+	var walk func(relativePath, prefix, childPrefix string)
+	walk = func(relativePath, prefix, childPrefix string) {
+		line := prefix + graph.name(relativePath)
+		if onPath[relativePath] {
+			lines = append(lines, line+" (cycle)")
+			return
+		} else if expanded[relativePath] && len(deps[relativePath]) > 0 {
+			lines = append(lines, line+" (*)")
+			return
+		}
+		lines = append(lines, line)
+		expanded[relativePath] = true
+		onPath[relativePath] = true
+		for i, dep := range deps[relativePath] {
+			if i == len(deps[relativePath])-1 {
+				walk(dep, childPrefix+"└── ", childPrefix+"    ")
+			} else {
+				walk(dep, childPrefix+"├── ", childPrefix+"│   ")
+			}
+		}
+		onPath[relativePath] = false
 	}
+	for _, module := range modules {
+		if !hasDependents[module.RelativePath] {
+			walk(module.RelativePath, "", "")
+		}
+	}
+	// modules only reachable through a cycle
+	for _, module := range modules {
+		if !expanded[module.RelativePath] {
+			walk(module.RelativePath, "", "")
+		}
+	}
+	return lines
+}
 
-	if err := cmd.Config.WriteRootConfig(rootConfig); err != nil {
+// List implements `gorepo list`
+func (cmd *Commands) List(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+	modules, err := cmd.Config.GetModules([]string{"all"}, []string{}, false)
+	if err != nil {
 		return err
+	}
+	if c.Bool("scripts") {
+		return cmd.listScripts(modules)
+	}
+	if len(modules) == 0 {
+		cmd.SystemUtils.Logger.InfoLn("no modules found")
 	} else {
-		if verbose {
-			cmd.SystemUtils.Logger.VerboseLn("created monorepo configuration 'work.toml' at root")
+		for _, module := range modules {
+			cmd.SystemUtils.Logger.DefaultLn(module.Name)
+		}
+	}
+	return nil
+}
+
+// listScripts prints the scripts of the root and of every module with their description
+func (cmd *Commands) listScripts(modules []ModuleConfig) error {
+	rootConfig, err := cmd.Config.LoadRootConfig()
+	if err != nil {
+		return err
+	}
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 3, ' ', 0)
+	printScripts := func(name string, scripts map[string]Script) {
+		_, _ = fmt.Fprintln(w, name+"\t")
+		if len(scripts) == 0 {
+			_, _ = fmt.Fprintln(w, "  no scripts\t")
+		}
+		names := make([]string, 0, len(scripts))
+		for scriptName := range scripts {
+			names = append(names, scriptName)
+		}
+		sort.Strings(names)
+		for _, scriptName := range names {
+			_, _ = fmt.Fprintln(w, "  "+scriptName+"\t"+scripts[scriptName].Description)
 		}
 	}
+	if len(rootConfig.Scripts) > 0 {
+		printScripts("root", rootConfig.Scripts)
+	}
+	for _, module := range modules {
+		printScripts(module.Name, module.Scripts)
+	}
+	_ = w.Flush()
+	if table.Len() == 0 {
+		cmd.SystemUtils.Logger.InfoLn("no modules found")
+		return nil
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		cmd.SystemUtils.Logger.DefaultLn(strings.TrimRight(line, " "))
+	}
+	return nil
+}
 
-	// todo: check existence of modules folder (go.mod) to sanitize everything (create module.toml and make sure they are in the workspace)
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
 
-	cmd.SystemUtils.Logger.SuccessLn("monorepo successfully initialized at " + cmd.Config.Runtime.ROOT)
+// Statuses of a task ran by runTasks
+const (
+	statusOk            = "ok"
+	statusFailed        = "failed"
+	statusSkipped       = "skipped"
+	statusMissingScript = "missing script"
+	statusCached        = "cached"
+	statusTimedOut      = "timed out"
+	statusInterrupted   = "interrupted"
+)
 
-	return nil
+// runTask is a unit of work scheduled by runTasks
+type runTask struct {
+	Name       string // name used to prefix the output in parallel mode
+	Deps       []int  // indexes of the tasks that must succeed before this one starts
+	SkipStatus string // when set, the task is not run and reported with this status
+	// Timeout after which the context of Run is cancelled, 0 for none
+	Timeout time.Duration
+	// Run runs the task, it can return a status to report instead of ok
+	Run func(ctx context.Context, stdout, stderr io.Writer) (status string, err error)
 }
 
-func (cmd *Commands) Add(c *cli.Context) error {
-	if exists := cmd.Config.RootConfigExists(); !exists {
-		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+// runOptions contains the options of runTasks
+type runOptions struct {
+	Parallel  int  // max number of tasks running at once
+	KeepGoing bool // run every task instead of stopping at the first failure
+}
+
+// taskResult is the outcome of a task
+type taskResult struct {
+	Status   string
+	Duration time.Duration
+	ExitCode int
+	Err      error
+}
+
+// succeeded tells if the tasks depending on this one can run
+func (r taskResult) succeeded() bool {
+	return r.Status == statusOk || r.Status == statusMissingScript || r.Status == statusCached
+}
+
+// failed tells if the task ran and did not succeed
+func (r taskResult) failed() bool {
+	return r.Status == statusFailed || r.Status == statusTimedOut || r.Status == statusInterrupted
+}
+
+// interruptError is the cause of the cancellation of the context of a command interrupted by a signal
+type interruptError struct {
+	Signal os.Signal
+}
+
+func (e *interruptError) Error() string {
+	return "interrupted by " + e.Signal.String()
+}
+
+// interruptible wraps a command that runs scripts, on SIGINT or SIGTERM its context is cancelled with
+// an interruptError, so that the signal is forwarded to the scripts (see Exec.Command)
+func (cmd *Commands) interruptible(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		ctx, cancel := context.WithCancelCause(c.Context)
+		defer cancel(nil)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go func() {
+			select {
+			case sig := <-signals:
+				cmd.SystemUtils.Logger.WarningLn("received " + sig.String() + ", stopping the running scripts")
+				cancel(&interruptError{Signal: sig})
+			case <-ctx.Done():
+			}
+		}()
+		c.Context = ctx
+		return action(c)
 	}
-	relativePathAndNameInput := c.Args().Get(0)
-	cmd.SystemUtils.Logger.VerboseLn("relativePathAndNameInput: " + relativePathAndNameInput)
-	if relativePathAndNameInput == "" {
-		return errors.New("error: no name provided")
+}
+
+// scriptTimeout returns the timeout of the script (see decodeScripts for the timeouts section),
+// or the default timeout
+func scriptTimeout(script Script, scriptName string, defaultTimeout time.Duration) (timeout time.Duration, err error) {
+	if script.Timeout == "" {
+		return defaultTimeout, nil
 	}
-	name := filepath.Base(relativePathAndNameInput)
-	cmd.SystemUtils.Logger.VerboseLn("name: " + name)
-	if modules, err := cmd.Config.GetModules([]string{"all"}, []string{}); err != nil {
-		return err
-	} else {
-		for _, module := range modules {
-			if module.Name == name {
-				return errors.New("module with name " + name + " already exists at " + module.RelativePath)
+	if timeout, err = time.ParseDuration(script.Timeout); err != nil {
+		return 0, errors.New("invalid timeout '" + script.Timeout + "' for script " + scriptName)
+	}
+	return timeout, nil
+}
+
+// runTasks runs tasks in order, or concurrently with at most `Parallel` tasks at once.
+// In parallel mode, the output of each task is forwarded line by line with a prefix.
+// By default no new task is started after a failure, and the error of the first failing task
+// (in the order of the tasks, not of completion) is returned. With `KeepGoing`, every task whose
+// dependencies succeeded is run, a summary is printed and an error is returned if any failed.
+// A task that does not finish before its timeout is reported as timed out. When the context is
+// cancelled by a signal (see interruptible), no new task is started, the running tasks are reported
+// as interrupted and so is the returned error.
+func (cmd *Commands) runTasks(ctx context.Context, tasks []runTask, opts runOptions) (results []taskResult, err error) {
+	parallel := max(opts.Parallel, 1)
+	results = make([]taskResult, len(tasks))
+	started := make([]bool, len(tasks))
+	done := make([]bool, len(tasks))
+	finished := make(chan int)
+	var outputMu sync.Mutex
+	running := 0
+	failed := false
+	for {
+		for i, task := range tasks {
+			if running >= parallel || (failed && !opts.KeepGoing) || ctx.Err() != nil {
+				break
 			}
+			if started[i] || !allDone(done, task.Deps) {
+				continue
+			}
+			started[i] = true
+			if !allSucceeded(results, task.Deps) {
+				cmd.SystemUtils.Logger.WarningLn("skipping " + task.Name + ", a dependency did not succeed")
+				results[i] = taskResult{Status: statusSkipped}
+				done[i] = true
+				continue
+			}
+			if task.SkipStatus != "" {
+				cmd.SystemUtils.Logger.InfoLn("skipping " + task.Name + " (" + task.SkipStatus + ")")
+				results[i] = taskResult{Status: task.SkipStatus}
+				done[i] = true
+				continue
+			}
+			running++
+			go func(i int, task runTask) {
+				var stdout, stderr *lineWriter
+				if parallel > 1 {
+					stdout = newLineWriter("["+task.Name+"] ", &outputMu, cmd.SystemUtils.Logger.Default)
+					stderr = newLineWriter("["+task.Name+"] ", &outputMu, writeStderr)
+				}
+				taskCtx, cancel := ctx, context.CancelFunc(func() {})
+				if task.Timeout > 0 {
+					taskCtx, cancel = context.WithTimeout(ctx, task.Timeout)
+				}
+				start := time.Now()
+				var status string
+				var err error
+				if stdout != nil {
+					status, err = task.Run(taskCtx, stdout, stderr)
+					stdout.Flush()
+					stderr.Flush()
+				} else {
+					status, err = task.Run(taskCtx, nil, nil)
+				}
+				results[i] = taskResult{Status: status, Duration: time.Since(start), ExitCode: exitCode(err), Err: err}
+				var interrupt *interruptError
+				if err != nil && errors.As(context.Cause(ctx), &interrupt) {
+					results[i].Status = statusInterrupted
+				} else if err != nil && errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+					results[i].Status = statusTimedOut
+					results[i].Err = fmt.Errorf("%s timed out after %s", task.Name, task.Timeout)
+					if opts.KeepGoing {
+						// the returned error only names the failed tasks, otherwise it is this one
+						cmd.SystemUtils.Logger.WarningLn(results[i].Err.Error())
+					}
+				} else if err != nil {
+					results[i].Status = statusFailed
+				} else if status == "" {
+					results[i].Status = statusOk
+				}
+				cancel()
+				finished <- i
+			}(i, task)
+		}
+		if running == 0 {
+			break
+		}
+		i := <-finished
+		running--
+		done[i] = true
+		if results[i].failed() {
+			failed = true
 		}
 	}
-	newModule := ModuleConfig{
-		Name:         name,
-		RelativePath: relativePathAndNameInput,
-		Template:     "@default",
-		Type:         "executable",
-		Main:         "",
-		Priority:     0,
-		Scripts:      map[string]string{},
+	var failedNames, interruptedNames []string
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = statusSkipped
+		}
+		if results[i].failed() {
+			failedNames = append(failedNames, tasks[i].Name)
+		}
+		if results[i].Status == statusInterrupted {
+			interruptedNames = append(interruptedNames, tasks[i].Name)
+		}
+	}
+	if opts.KeepGoing {
+		cmd.printSummary(tasks, results)
+	}
+	if len(interruptedNames) > 0 {
+		return results, errors.New("interrupted in: " + strings.Join(interruptedNames, ", "))
+	} else if ctx.Err() != nil {
+		return results, context.Cause(ctx)
+	}
+	if opts.KeepGoing {
+		if len(failedNames) > 0 {
+			return results, errors.New("failed in: " + strings.Join(failedNames, ", "))
+		}
+		return results, nil
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			return results, result.Err
+		}
+	}
+	return results, nil
+}
+
+func allDone(done []bool, indexes []int) bool {
+	for _, i := range indexes {
+		if !done[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func allSucceeded(results []taskResult, indexes []int) bool {
+	for _, i := range indexes {
+		if !results[i].succeeded() {
+			return false
+		}
+	}
+	return true
+}
+
+// exitCode returns the exit code of a command from the error it returned
+func exitCode(err error) int {
+	if err == nil {
+		return 0
 	}
-	absolutePath := filepath.Join(cmd.Config.Runtime.ROOT, relativePathAndNameInput)
-	if err := cmd.Config.WriteModuleConfig(newModule, absolutePath); err != nil {
-		return err
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
 	}
-	if err := cmd.SystemUtils.Exec.GoCommand(absolutePath, "mod", "init", name); err != nil {
-		return err
+	return 1
+}
+
+// printSummary prints a table with the outcome of every task
+func (cmd *Commands) printSummary(tasks []runTask, results []taskResult) {
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "MODULE\tSTATUS\tDURATION\tEXIT CODE")
+	for i, result := range results {
+		duration, code := "-", "-"
+		if result.Status == statusOk || result.Status == statusFailed || result.Status == statusCached {
+			duration = result.Duration.Round(time.Millisecond).String()
+			code = strconv.Itoa(result.ExitCode)
+		} else if result.Status == statusTimedOut || result.Status == statusInterrupted {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		_, _ = fmt.Fprintln(w, tasks[i].Name+"\t"+result.Status+"\t"+duration+"\t"+code)
 	}
-	if config, err := cmd.Config.LoadRootConfig(); err != nil {
-		return err
-	} else if config.Strategy == "workspace" {
-		if err := cmd.SystemUtils.Exec.GoCommand(cmd.Config.Runtime.ROOT, "work", "use", relativePathAndNameInput); err != nil {
-			return err
+	_ = w.Flush()
+	cmd.SystemUtils.Logger.InfoLn("SUMMARY")
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		cmd.SystemUtils.Logger.DefaultLn(line)
+	}
+}
+
+// lineWriter forwards complete lines to a write function, so that concurrent outputs do not interleave mid-line
+type lineWriter struct {
+	prefix string
+	mu     *sync.Mutex
+	write  func(line string)
+	buf    []byte
+}
+
+func newLineWriter(prefix string, mu *sync.Mutex, write func(line string)) *lineWriter {
+	return &lineWriter{prefix: prefix, mu: mu, write: write}
+}
+
+// writeStderr writes a line to the stderr of the process, the errors of scripts are not logged
+// to stdout so that they can still be redirected
+func writeStderr(line string) {
+	_, _ = io.WriteString(os.Stderr, line)
+}
+
+// Write implements io.Writer
+func (w *lineWriter) Write(p []byte) (n int, err error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
 		}
+		w.writeLine(string(w.buf[:i+1]))
+		w.buf = w.buf[i+1:]
 	}
-	return nil
+	return len(p), nil
 }
 
-// List implements `gorepo list`
-func (cmd *Commands) List(c *cli.Context) error {
-	if exists := cmd.Config.RootConfigExists(); !exists {
-		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+// Flush writes what remains in the buffer
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(string(w.buf) + "\n")
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) writeLine(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.write(w.prefix + line)
+}
+
+// targetModules reads the flags selecting the modules of the commands running in modules (--target,
+// --exclude, --strict-targets and --affected) and returns the targeted modules sorted by the graph,
+// with the indexes of the modules each one requires (see ModuleGraph.Sort). No module is returned
+// when --affected leaves none. The root is not a module, the commands check --target=root before.
+func (cmd *Commands) targetModules(c *cli.Context) (graph ModuleGraph, modules []ModuleConfig, deps [][]int, err error) {
+	verbose := c.Bool("verbose")
+
+	targets := strings.Split(c.String("target"), ",")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag target:       " + strings.Join(targets, ","))
+	}
+
+	exclude := strings.Split(c.String("exclude"), ",")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag exclude:      " + strings.Join(exclude, ","))
 	}
-	modules, err := cmd.Config.GetModules([]string{"all"}, []string{})
+
+	strictTargets := c.Bool("strict-targets")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag strictTargets: " + strconv.FormatBool(strictTargets))
+	}
+
+	affected, _ := c.Generic("affected").(*affectedValue)
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag affected:     " + affected.String())
+	}
+
+	modules, err = cmd.Config.GetModules(targets, exclude, strictTargets)
 	if err != nil {
-		return err
+		return graph, nil, nil, err
 	}
+
 	if len(modules) == 0 {
-		cmd.SystemUtils.Logger.InfoLn("no modules found")
-	} else {
-		for _, module := range modules {
-			cmd.SystemUtils.Logger.DefaultLn(module.Name)
+		return graph, nil, nil, errors.New("no modules found")
+	}
+
+	if affected != nil && affected.Enabled {
+		if modules, err = cmd.Config.FilterAffectedModules(c.Context, modules, affected.Ref); err != nil {
+			return graph, nil, nil, err
+		}
+		if len(modules) == 0 {
+			cmd.SystemUtils.Logger.InfoLn("no affected modules")
+			return graph, nil, nil, nil
 		}
 	}
-	return nil
+
+	if graph, err = cmd.Config.GetModuleGraph(); err != nil {
+		return graph, nil, nil, err
+	}
+	modules, deps, err = graph.Sort(modules)
+	return graph, modules, deps, err
 }
 
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
+// runFlags reads the flags of the commands running in modules that are passed to runTasks
+// (--timeout, --parallel and --keep-going)
+func (cmd *Commands) runFlags(c *cli.Context) (timeout time.Duration, opts runOptions) {
+	verbose := c.Bool("verbose")
+
+	timeout = c.Duration("timeout")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag timeout:      " + timeout.String())
 	}
-	return false
+
+	parallel := c.Int("parallel")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag parallel:     " + strconv.Itoa(parallel))
+	}
+
+	keepGoing := c.Bool("keep-going")
+	if verbose {
+		cmd.SystemUtils.Logger.VerboseLn("value for flag keepGoing:    " + strconv.FormatBool(keepGoing))
+	}
+
+	return timeout, runOptions{Parallel: parallel, KeepGoing: keepGoing}
 }
 
 // Execute implements `gorepo execute`
@@ -650,36 +3777,69 @@ func (cmd *Commands) Execute(c *cli.Context) error {
 		}
 	}
 
+	// flags are not parsed after the script name, so only the arguments after -- go to the script
+	args := c.Args().Tail()
+	if len(args) > 0 && args[0] != "--" {
+		return errors.New("unexpected arguments after the script name: " + strings.Join(args, " ") +
+			", put the flags before the script name, or the arguments of the script after --")
+	} else if len(args) > 0 {
+		args = args[1:]
+	}
+	if verbose && len(args) > 0 {
+		cmd.SystemUtils.Logger.VerboseLn("passing arguments " + shellJoin(args))
+	}
+
 	allowMissing := c.Bool("allow-missing")
 	if verbose {
 		cmd.SystemUtils.Logger.VerboseLn("value for flag allowMissing: " + strconv.FormatBool(allowMissing))
 	}
 
-	targets := strings.Split(c.String("target"), ",")
+	useCache := c.Bool("cache")
 	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag target:       " + strings.Join(targets, ","))
+		cmd.SystemUtils.Logger.VerboseLn("value for flag cache:        " + strconv.FormatBool(useCache))
 	}
-
-	exclude := strings.Split(c.String("exclude"), ",")
-	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag exclude:      " + strings.Join(exclude, ","))
+	if useCache && c.Bool("dry-run") {
+		// the scripts do not run, so their result must neither be looked up nor stored
+		cmd.SystemUtils.Logger.InfoLn("dry run: the cache is not used")
+		useCache = false
 	}
 
-	// logic
+	timeout, opts := cmd.runFlags(c)
 
-	if targets[0] == "root" {
-		cmd.SystemUtils.Logger.WarningLn("running script in root not supported yet")
-		// implement here and return
-		return nil
-	}
+	// logic
 
-	modules, err := cmd.Config.GetModules(targets, exclude)
-	if err != nil {
+	if c.String("target") == "root" {
+		rootConfig, err := cmd.Config.LoadRootConfig()
+		if err != nil {
+			return err
+		}
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("checking if root has the script")
+		}
+		script := rootConfig.Scripts[scriptName]
+		if script.Run == "" {
+			return errors.New("not running script, because it is missing in root '" + scriptName + "'")
+		}
+		if verbose {
+			cmd.SystemUtils.Logger.VerboseLn("root has the script")
+		}
+		root := ModuleConfig{Name: "root", Scripts: rootConfig.Scripts}
+		scriptTasks, err := ModuleGraph{}.ScriptTasks([]ModuleConfig{root}, [][]int{nil}, scriptName)
+		if err != nil {
+			return err
+		}
+		passArgs(scriptTasks, scriptName, args)
+		tasks, err := cmd.scriptRunTasks(scriptTasks, scriptName, timeout, nil)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.runTasks(c.Context, tasks, runOptions{Parallel: 1})
 		return err
 	}
 
-	if len(modules) == 0 {
-		return errors.New("no modules found")
+	graph, modules, deps, err := cmd.targetModules(c)
+	if err != nil || len(modules) == 0 {
+		return err
 	}
 
 	// check all modules have the script
@@ -688,7 +3848,7 @@ func (cmd *Commands) Execute(c *cli.Context) error {
 	}
 	var modulesWithoutScript []string
 	for _, module := range modules {
-		if _, ok := module.Scripts[scriptName]; !ok || module.Scripts[scriptName] == "" {
+		if module.Scripts[scriptName].Run == "" {
 			modulesWithoutScript = append(modulesWithoutScript, module.Name)
 		}
 	}
@@ -706,25 +3866,165 @@ func (cmd *Commands) Execute(c *cli.Context) error {
 		}
 	}
 
-	// execute them
-	for _, module := range modules {
-		path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
-		script := module.Scripts[scriptName]
-		if script == "" {
-			cmd.SystemUtils.Logger.InfoLn("script is empty, skipping")
+	// execute them, with the scripts they depend on
+	scriptTasks, err := graph.ScriptTasks(modules, deps, scriptName)
+	if err != nil {
+		return err
+	}
+	passArgs(scriptTasks, scriptName, args)
+	var cacheGraph *ModuleGraph
+	if useCache {
+		cacheGraph = &graph
+	}
+	tasks, err := cmd.scriptRunTasks(scriptTasks, scriptName, timeout, cacheGraph)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.runTasks(c.Context, tasks, opts)
+	return err
+}
+
+// passArgs appends the arguments given after the script name to the requested script, but not to
+// the scripts it depends on. They are also available to the script as $GOREPO_ARGS.
+func passArgs(scriptTasks []scriptTask, scriptName string, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	for i, task := range scriptTasks {
+		if task.ScriptName != scriptName || task.Script.Run == "" {
 			continue
 		}
-		cmd.SystemUtils.Logger.InfoLn("running script " + scriptName + " in module " + module.Name)
-		if err := cmd.SystemUtils.Exec.BashCommand(path, script); err != nil {
-			return err
+		env := map[string]string{}
+		for key, value := range task.Script.Env {
+			env[key] = value
 		}
+		env["GOREPO_ARGS"] = shellJoin(args)
+		scriptTasks[i].Script.Run += " " + shellJoin(args)
+		scriptTasks[i].Script.Env = env
 	}
+}
 
-	return nil
+// shellJoin quotes the arguments that need it for sh and joins them with spaces
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
 }
 
-// FmtCI implements `gorepo fmt-ci`
-func (cmd *Commands) FmtCI(c *cli.Context) error {
+// scriptRunTasks turns the tasks of ScriptTasks into tasks of runTasks, named after their module,
+// or module:script when other scripts than the requested one run. A module without the script is skipped.
+// The root is a module without relative path. When a graph is passed, the outputs are cached.
+func (cmd *Commands) scriptRunTasks(scriptTasks []scriptTask, scriptName string, defaultTimeout time.Duration, cacheGraph *ModuleGraph) (tasks []runTask, err error) {
+	rootConfig, err := cmd.Config.LoadRootConfig()
+	if err != nil {
+		return nil, err
+	}
+	qualified := false
+	for _, task := range scriptTasks {
+		qualified = qualified || task.ScriptName != scriptName
+	}
+	for _, task := range scriptTasks {
+		module, name, script := task.Module, task.ScriptName, task.Script
+		where := "module " + module.Name
+		if module.RelativePath == "" {
+			where = "root"
+		}
+		timeout, err := scriptTimeout(script, name, defaultTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %s", err, where)
+		}
+		path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
+		env := standardEnv(cmd.Config.Runtime.ROOT, rootConfig, module, name)
+		runTask := runTask{
+			Name:    module.Name,
+			Deps:    task.Deps,
+			Timeout: timeout,
+			Run: func(ctx context.Context, stdout, stderr io.Writer) (string, error) {
+				if cacheGraph != nil {
+					return cmd.runCachedScript(ctx, *cacheGraph, module, name, script, env, stdout, stderr)
+				}
+				cmd.SystemUtils.Logger.InfoLn("running script " + name + " in " + where)
+				_, err := cmd.SystemUtils.Exec.BashCommand(ctx, script.dir(path), script.Run, script.execOptions(env, stdout, stderr))
+				return "", err
+			},
+		}
+		if qualified {
+			runTask.Name = module.Name + ":" + name
+		}
+		if script.Run == "" {
+			runTask.SkipStatus = statusMissingScript
+		}
+		tasks = append(tasks, runTask)
+	}
+	return tasks, nil
+}
+
+// runCachedScript replays the output of a script if a cache entry exists for its inputs,
+// otherwise it runs the script with the variables of env and caches its output if it succeeds
+func (cmd *Commands) runCachedScript(ctx context.Context, graph ModuleGraph, module ModuleConfig, scriptName string, script Script, env []string, stdout, stderr io.Writer) (status string, err error) {
+	key, err := cmd.Config.CacheKey(graph, module, scriptName, script)
+	if err != nil {
+		return "", err
+	}
+	if entry, found, err := cmd.Config.ReadCache(key); err != nil {
+		return "", err
+	} else if found {
+		cmd.SystemUtils.Logger.InfoLn("replaying cached output of script " + scriptName + " in module " + module.Name)
+		if stdout != nil {
+			_, _ = io.WriteString(stdout, entry.Output)
+		} else {
+			cmd.SystemUtils.Logger.Default(entry.Output)
+		}
+		return statusCached, nil
+	}
+	if stdout == nil {
+		var outputMu sync.Mutex
+		stdoutLines := newLineWriter("", &outputMu, cmd.SystemUtils.Logger.Default)
+		stderrLines := newLineWriter("", &outputMu, writeStderr)
+		defer stdoutLines.Flush()
+		defer stderrLines.Flush()
+		stdout, stderr = stdoutLines, stderrLines
+	}
+	var output safeBuffer
+	cmd.SystemUtils.Logger.InfoLn("running script " + scriptName + " in module " + module.Name)
+	path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
+	if _, err := cmd.SystemUtils.Exec.BashCommand(ctx, script.dir(path), script.Run, script.execOptions(env,
+		io.MultiWriter(stdout, &output),
+		io.MultiWriter(stderr, &output),
+	)); err != nil {
+		return "", err
+	}
+	return "", cmd.Config.WriteCache(key, CacheEntry{Module: module.Name, Script: scriptName, Output: output.String()})
+}
+
+// safeBuffer is a buffer that can be written to concurrently
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer
+func (b *safeBuffer) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the content of the buffer
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Exec implements `gorepo exec`
+func (cmd *Commands) Exec(c *cli.Context) error {
 	if exists := cmd.Config.RootConfigExists(); !exists {
 		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
 	}
@@ -734,35 +4034,124 @@ func (cmd *Commands) FmtCI(c *cli.Context) error {
 		cmd.SystemUtils.Logger.VerboseLn("verbose mode enabled")
 	}
 
-	targets := strings.Split(c.String("target"), ",")
+	argv := c.Args().Slice()
+	if len(argv) > 0 && argv[0] == "--" {
+		argv = argv[1:]
+	}
+	if len(argv) == 0 {
+		return errors.New("no command provided, usage: gorepo exec [--target] [--exclude] -- <command...>")
+	}
+
+	noShell := c.Bool("no-shell")
 	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag target:       " + strings.Join(targets, ","))
+		cmd.SystemUtils.Logger.VerboseLn("value for flag noShell:      " + strconv.FormatBool(noShell))
 	}
 
-	exclude := strings.Split(c.String("exclude"), ",")
+	timeout, opts := cmd.runFlags(c)
+
+	// without --no-shell, the arguments are joined like ssh does, so that `gorepo exec -- 'go list ./... | wc -l'` works
+	command := strings.Join(argv, " ")
+	if noShell {
+		command = shellJoin(argv)
+	}
+	rootConfig, err := cmd.Config.LoadRootConfig()
+	if err != nil {
+		return err
+	}
+	run := func(ctx context.Context, module ModuleConfig, stdout, stderr io.Writer) error {
+		path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
+		opts := ExecOptions{Stdout: stdout, Stderr: stderr, Env: standardEnv(cmd.Config.Runtime.ROOT, rootConfig, module, "")}
+		var err error
+		if noShell {
+			_, err = cmd.SystemUtils.Exec.Command(ctx, path, argv, opts)
+		} else {
+			_, err = cmd.SystemUtils.Exec.BashCommand(ctx, path, command, opts)
+		}
+		return err
+	}
+
+	if c.String("target") == "root" {
+		_, err := cmd.runTasks(c.Context, []runTask{{
+			Name:    "root",
+			Timeout: timeout,
+			Run: func(ctx context.Context, stdout, stderr io.Writer) (string, error) {
+				cmd.SystemUtils.Logger.InfoLn("running '" + command + "' in root")
+				return "", run(ctx, ModuleConfig{Name: "root"}, stdout, stderr)
+			},
+		}}, runOptions{Parallel: 1})
+		return err
+	}
+
+	_, modules, _, err := cmd.targetModules(c)
+	if err != nil || len(modules) == 0 {
+		return err
+	}
+
+	tasks := make([]runTask, 0, len(modules))
+	// the command does not depend on its result in the required modules, the graph only orders them
+	for _, module := range modules {
+		tasks = append(tasks, runTask{
+			Name:    module.Name,
+			Timeout: timeout,
+			Run: func(ctx context.Context, stdout, stderr io.Writer) (string, error) {
+				cmd.SystemUtils.Logger.InfoLn("running '" + command + "' in module " + module.Name)
+				return "", run(ctx, module, stdout, stderr)
+			},
+		})
+	}
+
+	_, err = cmd.runTasks(c.Context, tasks, opts)
+	return err
+}
+
+// FmtCI implements `gorepo fmt-ci`
+func (cmd *Commands) FmtCI(c *cli.Context) error {
+	if exists := cmd.Config.RootConfigExists(); !exists {
+		return errors.New("monorepo not found at " + cmd.Config.Runtime.ROOT)
+	}
+
+	verbose := c.Bool("verbose")
 	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag exclude:      " + strings.Join(exclude, ","))
+		cmd.SystemUtils.Logger.VerboseLn("verbose mode enabled")
 	}
 
-	if targets[0] == "root" {
+	timeout, opts := cmd.runFlags(c)
+
+	if c.String("target") == "root" {
 		return errors.New("running fmt in root is not supported")
 	}
 
-	modules, err := cmd.Config.GetModules(targets, exclude)
-	if err != nil {
+	_, modules, _, err := cmd.targetModules(c)
+	if err != nil || len(modules) == 0 {
 		return err
 	}
 
-	script := "if [ -n \"$(gofmt -l .)\" ]; then exit 1; fi"
+	script := "gofmt -l ."
 
+	tasks := make([]runTask, 0, len(modules))
+	// the checks do not depend on the result of the required modules, the graph only orders them
 	for _, module := range modules {
 		path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
-		if err := cmd.SystemUtils.Exec.BashCommand(path, script); err != nil {
-			return errors.New("error: fmt-ci failed in module " + module.Name)
-		}
+		name := module.Name
+		tasks = append(tasks, runTask{
+			Name:    name,
+			Timeout: timeout,
+			Run: func(ctx context.Context, stdout, stderr io.Writer) (string, error) {
+				// gofmt lists the files that are not formatted
+				result, err := cmd.SystemUtils.Exec.BashCommand(ctx, path, script, ExecOptions{Stdout: stdout, Stderr: stderr, Capture: true})
+				if err != nil {
+					return "", errors.New("error: fmt-ci failed in module " + name)
+				}
+				if files := strings.Fields(result.Stdout); len(files) > 0 {
+					return "", errors.New("error: fmt-ci failed in module " + name + ", not formatted: " + strings.Join(files, ", "))
+				}
+				return "", nil
+			},
+		})
 	}
 
-	return nil
+	_, err = cmd.runTasks(c.Context, tasks, opts)
+	return err
 }
 
 // VetCI implements `gorepo vet-ci`
@@ -776,35 +4165,38 @@ func (cmd *Commands) VetCI(c *cli.Context) error {
 		cmd.SystemUtils.Logger.VerboseLn("verbose mode enabled")
 	}
 
-	targets := strings.Split(c.String("target"), ",")
-	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag target:       " + strings.Join(targets, ","))
-	}
-
-	exclude := strings.Split(c.String("exclude"), ",")
-	if verbose {
-		cmd.SystemUtils.Logger.VerboseLn("value for flag exclude:      " + strings.Join(exclude, ","))
-	}
+	timeout, opts := cmd.runFlags(c)
 
-	if targets[0] == "root" {
+	if c.String("target") == "root" {
 		return errors.New("running vet-ci from root is not supported")
 	}
 
-	modules, err := cmd.Config.GetModules(targets, exclude)
-	if err != nil {
+	_, modules, _, err := cmd.targetModules(c)
+	if err != nil || len(modules) == 0 {
 		return err
 	}
 
 	script := "go vet . || exit 1"
 
+	tasks := make([]runTask, 0, len(modules))
+	// the checks do not depend on the result of the required modules, the graph only orders them
 	for _, module := range modules {
 		path := filepath.Join(cmd.Config.Runtime.ROOT, module.RelativePath)
-		if err := cmd.SystemUtils.Exec.BashCommand(path, script); err != nil {
-			return errors.New("error: vet-ci failed in module " + module.Name)
-		}
+		name := module.Name
+		tasks = append(tasks, runTask{
+			Name:    name,
+			Timeout: timeout,
+			Run: func(ctx context.Context, stdout, stderr io.Writer) (string, error) {
+				if _, err := cmd.SystemUtils.Exec.BashCommand(ctx, path, script, ExecOptions{Stdout: stdout, Stderr: stderr}); err != nil {
+					return "", errors.New("error: vet-ci failed in module " + name)
+				}
+				return "", nil
+			},
+		})
 	}
 
-	return nil
+	_, err = cmd.runTasks(c.Context, tasks, opts)
+	return err
 }
 
 // version is injected at build time
@@ -848,7 +4240,7 @@ func (cmd *Commands) Diagnostic(c *cli.Context) error {
 		cmd.SystemUtils.Logger.DefaultLn("STRATEGY......" + cfg.Strategy)
 		cmd.SystemUtils.Logger.DefaultLn("VENDOR........" + strconv.FormatBool(cfg.Vendor))
 
-		modules, err := cmd.Config.GetModules([]string{"all"}, []string{})
+		modules, err := cmd.Config.GetModules([]string{"all"}, []string{}, false)
 		if err != nil {
 			return err
 		}
@@ -868,7 +4260,7 @@ func (cmd *Commands) Diagnostic(c *cli.Context) error {
 			if len(module.Scripts) > 0 {
 				cmd.SystemUtils.Logger.DefaultLn("COMMANDS........")
 				for k, v := range module.Scripts {
-					cmd.SystemUtils.Logger.DefaultLn("  " + k + " -> " + v)
+					cmd.SystemUtils.Logger.DefaultLn("  " + k + " -> " + v.Run)
 				}
 			}
 		}
@@ -876,6 +4268,40 @@ func (cmd *Commands) Diagnostic(c *cli.Context) error {
 	return nil
 }
 
+// affectedValue is the value of the flag --affected[=<git-ref>], it can be passed without value like a boolean flag
+type affectedValue struct {
+	Enabled bool
+	Ref     string
+}
+
+// Set implements flag.Value
+func (v *affectedValue) Set(value string) error {
+	switch value {
+	case "true":
+		v.Enabled, v.Ref = true, ""
+	case "false":
+		v.Enabled, v.Ref = false, ""
+	default:
+		v.Enabled, v.Ref = true, value
+	}
+	return nil
+}
+
+// String implements flag.Value
+func (v *affectedValue) String() string {
+	if v == nil || !v.Enabled {
+		return ""
+	} else if v.Ref == "" {
+		return "merge-base with main"
+	}
+	return v.Ref
+}
+
+// IsBoolFlag allows passing --affected without value
+func (v *affectedValue) IsBoolFlag() bool {
+	return true
+}
+
 // Cli runs the CLI application
 func Cli() (err error) {
 	su := NewSystemUtils(&Fs{}, &Exec{}, NewLevelLogger(), &Os{})
@@ -888,54 +4314,179 @@ func Cli() (err error) {
 		&cli.StringFlag{
 			Name:  "target",
 			Value: "all",
-			Usage: "Target specific modules (comma separated)",
+			Usage: "Target modules with selectors (comma separated): names, globs, tag:, path:, type:, deps-of:, dependents-of:, combined with +",
 		},
 		&cli.StringFlag{
 			Name:  "exclude",
 			Value: "",
-			Usage: "Exclude specific modules (comma separated)",
+			Usage: "Exclude modules with selectors (comma separated), same syntax as --target",
+		},
+		&cli.BoolFlag{
+			Name:  "strict-targets",
+			Value: false,
+			Usage: "Fail when an exclude does not match any module, instead of printing a warning",
+		},
+		&cli.IntFlag{
+			Name:  "parallel",
+			Value: 1,
+			Usage: "Number of modules to run concurrently",
+		},
+		&cli.BoolFlag{
+			Name:  "keep-going",
+			Value: false,
+			Usage: "Run every targeted module even if some fail, and print a summary",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Value: 0,
+			Usage: "Kill the script of a module and the processes it started if it runs longer than this duration (e.g. 30s, 5m), unless module.toml sets a timeout for the script",
+		},
+		&cli.GenericFlag{
+			Name:  "affected",
+			Value: &affectedValue{},
+			Usage: "Only target modules changed since a git ref (default: merge-base with main) and their dependents, use as --affected or --affected=<git-ref>",
 		},
 	}
 	app := &cli.App{
 		Name:  "GOREPO",
 		Usage: "A CLI tool to manage Go monorepos",
+		Before: func(c *cli.Context) error {
+			if c.Bool("dry-run") {
+				su.Fs = NewDryRunFs(su.Fs, su.Logger)
+				su.Exec = NewDryRunExec(su.Exec, su.Logger)
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:   "init",
 				Usage:  "Initialize a new monorepo at the working directory",
-				Action: cmd.Init,
+				Action: cmd.transaction("init", cmd.Init),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "import",
+						Value: false,
+						Usage: "Import the existing folders with a go.mod as modules",
+					},
+				},
 			},
 			{
 				Name:   "add",
 				Usage:  "Add a new module",
-				Action: cmd.Add,
+				Action: cmd.transaction("add", cmd.Add),
 			},
 			{
-				Name:   "execute",
-				Usage:  "Execute a script across targeted modules",
-				Action: cmd.Execute,
+				Name:      "execute",
+				Usage:     "Execute a script across targeted modules",
+				ArgsUsage: "[script_name] [-- args...]",
+				Action:    cmd.interruptible(cmd.Execute),
 				Flags: append(executionFlags, &cli.BoolFlag{
 					Name:  "allow-missing",
 					Value: false,
 					Usage: "Allow executing the scripts, even if some module don't have it",
+				}, &cli.BoolFlag{
+					Name:  "cache",
+					Value: false,
+					Usage: "Skip modules whose files, dependencies, script and cache_env did not change since the last successful run, and replay their output",
+				}),
+			},
+			{
+				Name:      "exec",
+				Usage:     "Execute a command across targeted modules, without defining a script",
+				ArgsUsage: "-- <command...>",
+				Action:    cmd.interruptible(cmd.Exec),
+				Flags: append(executionFlags, &cli.BoolFlag{
+					Name:  "no-shell",
+					Value: false,
+					Usage: "Run the command and its arguments directly, instead of through sh -c",
 				}),
 			},
 			{
 				Name:   "fmt-ci",
 				Usage:  "Breaks if targeted modules are not formatted",
-				Action: cmd.FmtCI,
+				Action: cmd.interruptible(cmd.FmtCI),
 				Flags:  executionFlags,
 			},
 			{
 				Name:   "vet-ci",
 				Usage:  "Breaks if targeted modules have vet issues",
-				Action: cmd.VetCI,
+				Action: cmd.interruptible(cmd.VetCI),
 				Flags:  executionFlags,
 			},
+			{
+				Name:   "remove",
+				Usage:  "Remove a module from the monorepo",
+				Action: cmd.transaction("remove", cmd.Remove),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Value: false,
+						Usage: "Remove the module even if other modules still require it",
+					},
+					&cli.BoolFlag{
+						Name:  "archive",
+						Value: false,
+						Usage: "Move the module to " + filepath.Join(".gorepo", "archive") + " instead of deleting it",
+					},
+				},
+			},
+			{
+				Name:   "mv",
+				Usage:  "Move or rename a module, and rewrite its imports across the monorepo",
+				Action: cmd.transaction("mv", cmd.Move),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "module-path",
+						Value: "",
+						Usage: "New module path to write in go.mod and in the imports of the monorepo",
+					},
+				},
+			},
+			{
+				Name:   "check",
+				Usage:  "Check the consistency of go.mod, module.toml and go.work files",
+				Action: cmd.transaction("check", cmd.Check),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "fix",
+						Value: false,
+						Usage: "Fix the issues that can be fixed safely",
+					},
+				},
+			},
+			{
+				Name:   "undo",
+				Usage:  "Revert the changes of the last init, add, remove, mv or check --fix",
+				Action: cmd.Undo,
+			},
+			{
+				Name:   "graph",
+				Usage:  "Display the dependencies between the modules of the monorepo",
+				Action: cmd.Graph,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "tree",
+						Usage: "Output format: tree, dot, mermaid or json",
+					},
+					&cli.StringFlag{
+						Name:  "focus",
+						Value: "",
+						Usage: "Only show a module, its dependencies and its dependents",
+					},
+				},
+			},
 			{
 				Name:   "list",
 				Usage:  "List all modules of the monorepo",
 				Action: cmd.List,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "scripts",
+						Usage: "List the scripts of the root and of every module, with their description",
+						Value: false,
+					},
+				},
 			},
 			{
 				Name:   "version",
@@ -955,6 +4506,11 @@ func Cli() (err error) {
 				Usage: "Enable verbose logging for all commands",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the files that would be written and the commands that would run, without doing it",
+				Value: false,
+			},
 			&cli.BoolFlag{
 				Name:  "experimental",
 				Value: false,
@@ -1 +1,22 @@
 package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandAdd(t *testing.T) {
+	t.Run("should not write the optional fields that are not set in module.toml", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(map[string][]byte{
+			"/root/work.toml": []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+		}, nil)
+		c, _ := NewMockContext(nil, "libs/mod1")
+		if err := tk.cmd.Add(c); err != nil {
+			t.Fatal(err)
+		}
+		moduleToml := string(tk.MockFs.Files["/root/libs/mod1/module.toml"])
+		if moduleToml == "" || strings.Contains(moduleToml, "cache_env") || strings.Contains(moduleToml, "tags") {
+			t.Fatalf("expected no empty optional field, got %s", moduleToml)
+		}
+	})
+}
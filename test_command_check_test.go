@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"testing"
+)
+
+var testCheckFlags = []cli.Flag{
+	&cli.BoolFlag{Name: "fix"},
+}
+
+var testCheckFiles = map[string][]byte{
+	"/root/work.toml":            []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+	"/root/go.work":              []byte("go 1.22\n\nuse (\n\t./api\n\t./old\n)\n"),
+	"/root/api/module.toml":      []byte(""),
+	"/root/api/go.mod":           []byte("module example.com/api\n"),
+	"/root/cli/go.mod":           []byte("module example.com/cli\n"),
+	"/root/docs/module.toml":     []byte(""),
+	"/root/v2/api/module.toml":   []byte(""),
+	"/root/v2/api/go.mod":        []byte("module example.com/v2/api\n"),
+	"/root/api/vendor/x/go.mod":  []byte("module x\n"),
+	"/root/.gorepo/cache/go.mod": []byte("module x\n"),
+}
+
+func TestCommandCheck(t *testing.T) {
+	t.Run("should report every issue", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testCheckFiles, nil)
+		c, _ := NewMockContext(testCheckFlags)
+		err := tk.cmd.Check(c)
+		if err == nil || err.Error() != "6 issue(s) found" {
+			t.Fatalf("expected 6 issues, got %v", err)
+		}
+		expected := []string{
+			"WARNING: cli has a go.mod but no module.toml (fixable with --fix)",
+			"WARNING: docs has a module.toml but no go.mod",
+			"WARNING: several modules are named api: api, v2/api",
+			"WARNING: go.work uses old which does not contain a go.mod (fixable with --fix)",
+			"WARNING: cli is not in go.work (fixable with --fix)",
+			"WARNING: v2/api is not in go.work (fixable with --fix)",
+		}
+		logs := tk.MockLogger.Output()
+		for i, message := range expected {
+			if logs[i] != message {
+				t.Fatalf("expected %s, got %s", message, logs[i])
+			}
+		}
+		if len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected nothing to be fixed")
+		}
+	})
+	t.Run("should fix what can be fixed", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testCheckFiles, nil)
+		c, _ := NewMockContext(testCheckFlags, "--fix")
+		err := tk.cmd.Check(c)
+		if err == nil || err.Error() != "2 issue(s) found" {
+			t.Fatalf("expected 2 remaining issues, got %v", err)
+		}
+		if tk.MockFs.Files["/root/cli/module.toml"] == nil {
+			t.Fatal("expected cli/module.toml to be created")
+		}
+		commands := tk.MockExec.Output()
+		expected := []string{"go work edit -dropuse=old", "go work use cli", "go work use v2/api"}
+		if len(commands) != len(expected) {
+			t.Fatalf("expected %d commands, got %v", len(expected), commands)
+		}
+		for i, command := range expected {
+			if commands[i].Command != command {
+				t.Fatalf("expected %s, got %s", command, commands[i].Command)
+			}
+		}
+	})
+	t.Run("should keep the fixes when issues remain", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testCheckFiles, nil)
+		c, _ := NewMockContext(testCheckFlags, "--fix")
+		err := tk.cmd.transaction("check", tk.cmd.Check)(c)
+		if err == nil || err.Error() != "2 issue(s) found" {
+			t.Fatalf("expected 2 remaining issues, got %v", err)
+		}
+		if tk.MockFs.Files["/root/cli/module.toml"] == nil {
+			t.Fatal("expected cli/module.toml to be kept")
+		}
+		if tk.MockFs.Files["/root/.gorepo/journal/journal.json"] == nil {
+			t.Fatal("expected the fixes to be kept in the journal")
+		}
+	})
+}
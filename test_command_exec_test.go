@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"github.com/urfave/cli/v2"
+	"testing"
+)
+
+var testExecFlags = []cli.Flag{
+	&cli.StringFlag{Name: "target", Value: "all"},
+	&cli.StringFlag{Name: "exclude", Value: ""},
+	&cli.BoolFlag{Name: "strict-targets"},
+	&cli.IntFlag{Name: "parallel", Value: 1},
+	&cli.BoolFlag{Name: "keep-going"},
+	&cli.DurationFlag{Name: "timeout"},
+	&cli.BoolFlag{Name: "no-shell"},
+}
+
+func TestCommandExec(t *testing.T) {
+	t.Run("should run the command in every module without a script", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecFlags, "--", "go", "mod", "why", "example.com/x")
+		if err := tk.cmd.Exec(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(commands))
+		}
+		for _, command := range commands {
+			if command.Command != "go mod why example.com/x" {
+				t.Fatalf("expected 'go mod why example.com/x', got %v", commands)
+			}
+		}
+	})
+	t.Run("should run the command in the targeted modules", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecFlags, "--target=mod1", "--no-shell", "--", "ls", "-la")
+		if err := tk.cmd.Exec(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Dir != "/root/mod1" || commands[0].Command != "ls -la" {
+			t.Fatalf("expected 'ls -la' to run in /root/mod1, got %v", commands)
+		}
+	})
+	t.Run("should return an error without command", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecFlags, "--")
+		err := tk.cmd.Exec(c)
+		if err == nil || err.Error() != "no command provided, usage: gorepo exec [--target] [--exclude] -- <command...>" {
+			t.Fatalf("expected a missing command error, got %v", err)
+		}
+	})
+	t.Run("should run the command in the modules requiring a failed one with keep-going", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		tk.MockExec.Errors["/root/shared"] = errors.New("exit status 1")
+		tk.MockExec.Errors["/root/api"] = errors.New("exit status 1")
+		c, _ := NewMockContext(testExecFlags, "--keep-going", "--target=api,shared", "--", "go", "build", "./...")
+		err := tk.cmd.Exec(c)
+		if err == nil || err.Error() != "failed in: shared, api" {
+			t.Fatalf("expected 'failed in: shared, api', got %v", err)
+		}
+	})
+}
@@ -1 +1,302 @@
 package main
+
+import (
+	"context"
+	"errors"
+	"github.com/urfave/cli/v2"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var testExecuteFlags = []cli.Flag{
+	&cli.StringFlag{Name: "target", Value: "all"},
+	&cli.StringFlag{Name: "exclude", Value: ""},
+	&cli.BoolFlag{Name: "strict-targets"},
+	&cli.IntFlag{Name: "parallel", Value: 1},
+	&cli.BoolFlag{Name: "keep-going"},
+	&cli.BoolFlag{Name: "allow-missing"},
+	&cli.BoolFlag{Name: "cache"},
+	&cli.DurationFlag{Name: "timeout"},
+}
+
+var testExecuteFiles = map[string][]byte{
+	"/root/work.toml":             []byte("name = 'my-monorepo'\nstrategy = 'workspace'\n[scripts]\ngenerate = 'echo root'"),
+	"/root/mod1/module.toml":      []byte("[scripts]\ntest = 'echo mod1'"),
+	"/root/mod2/module.toml":      []byte("[scripts]\ntest = 'echo mod2'"),
+	"/root/libs/mod3/module.toml": []byte("[scripts]\ntest = 'echo mod3'"),
+}
+
+func TestCommandExecute(t *testing.T) {
+	t.Run("should run the script in every module", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(commands))
+		}
+		if commands[0].Dir != "/root/mod1" || commands[1].Dir != "/root/mod2" || commands[2].Dir != "/root/libs/mod3" {
+			t.Fatalf("unexpected order %v", commands)
+		}
+	})
+	t.Run("should run the script in every module in parallel", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "--parallel=2", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockExec.Output()) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(tk.MockExec.Output()))
+		}
+	})
+	t.Run("should run the script of work.toml in root", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "--target=root", "generate")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Dir != "/root" || commands[0].Command != "echo root" {
+			t.Fatalf("expected 'echo root' to run in /root, got %v", commands)
+		}
+	})
+	t.Run("should return an error if the script is missing in root", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "--target=root", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "not running script, because it is missing in root 'test'" {
+			t.Fatalf("expected a missing script error, got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected no command to run")
+		}
+	})
+	t.Run("should return the error of the first failing module in parallel", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockExec.Errors["/root/mod1"] = errors.New("mod1 failed")
+		tk.MockExec.Errors["/root/mod2"] = errors.New("mod2 failed")
+		c, _ := NewMockContext(testExecuteFlags, "--parallel=3", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "mod1 failed" {
+			t.Fatalf("expected 'mod1 failed', got %v", err)
+		}
+	})
+	t.Run("should run every module and print a summary with keep-going", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockExec.Errors["/root/mod1"] = errors.New("mod1 failed")
+		c, _ := NewMockContext(testExecuteFlags, "--keep-going", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "failed in: mod1" {
+			t.Fatalf("expected 'failed in: mod1', got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(tk.MockExec.Output()))
+		}
+		logs := strings.Join(tk.MockLogger.Output(), "\n")
+		if !strings.Contains(logs, "DEFAULT: mod1     failed") || !strings.Contains(logs, "DEFAULT: mod2     ok") {
+			t.Fatalf("expected a summary, got %s", logs)
+		}
+	})
+	t.Run("should replay the cached output when nothing changed with cache", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "--cache", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockExec.Output()) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(tk.MockExec.Output()))
+		}
+		tk.MockFs.Files["/root/mod2/main.go"] = []byte("package main")
+		c, _ = NewMockContext(testExecuteFlags, "--cache", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 4 || commands[3].Dir != "/root/mod2" {
+			t.Fatalf("expected only mod2 to run again, got %v", commands)
+		}
+	})
+	t.Run("should report the modules that exceed the timeout", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockExec.Delays["/root/mod2"] = time.Minute
+		c, _ := NewMockContext(testExecuteFlags, "--timeout=10ms", "--keep-going", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "failed in: mod2" {
+			t.Fatalf("expected 'failed in: mod2', got %v", err)
+		}
+		logs := strings.Join(tk.MockLogger.Output(), "\n")
+		if !strings.Contains(logs, "WARNING: mod2 timed out after 10ms") || !strings.Contains(logs, "DEFAULT: mod2     timed out") {
+			t.Fatalf("expected mod2 to time out, got %s", logs)
+		}
+	})
+	t.Run("should use the timeout of the script in module.toml", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts]\ntest = 'echo mod1'\n[timeouts]\ntest = '10ms'")
+		tk.MockExec.Delays["/root/mod1"] = time.Minute
+		c, _ := NewMockContext(testExecuteFlags, "--timeout=1h", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "mod1 timed out after 10ms" {
+			t.Fatalf("expected 'mod1 timed out after 10ms', got %v", err)
+		}
+		if logs := strings.Join(tk.MockLogger.Output(), "\n"); strings.Contains(logs, "timed out after") {
+			t.Fatalf("expected the timeout to only be returned, got %s", logs)
+		}
+	})
+	t.Run("should run a table script in its dir", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.test]\nrun = 'go test ./...'\ndir = 'internal'\nenv = { CGO_ENABLED = '0' }")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Dir != "/root/mod1/internal" || commands[0].Command != "go test ./..." {
+			t.Fatalf("expected 'go test ./...' to run in /root/mod1/internal, got %v", commands)
+		}
+	})
+	t.Run("should return an error for an unknown field in a table script", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.test]\nrun = 'go test ./...'\ndescrption = 'Run the tests'")
+		c, _ := NewMockContext(testExecuteFlags, "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "mod1/module.toml: unknown field descrption in script test" {
+			t.Fatalf("expected an unknown field error, got %v", err)
+		}
+	})
+	t.Run("should use the timeout in the table of a table script", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.test]\nrun = 'echo mod1'\ntimeout = '10ms'")
+		tk.MockExec.Delays["/root/mod1"] = time.Minute
+		c, _ := NewMockContext(testExecuteFlags, "--timeout=1h", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "mod1 timed out after 10ms" {
+			t.Fatalf("expected 'mod1 timed out after 10ms', got %v", err)
+		}
+	})
+	t.Run("should return an error for the timeout of a table script in the timeouts section", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.test]\nrun = 'echo mod1'\n[timeouts]\ntest = '10ms'")
+		c, _ := NewMockContext(testExecuteFlags, "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "mod1/module.toml: timeout of script test in the timeouts section, set it in its table instead" {
+			t.Fatalf("expected a timeouts section error, got %v", err)
+		}
+	})
+	t.Run("should run the scripts a script depends on in the same module first", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts]\ngenerate = 'go generate ./...'\n[scripts.test]\nrun = 'go test ./...'\ndepends_on = ['generate']")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1", "--keep-going", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 2 || commands[0].Command != "go generate ./..." || commands[1].Command != "go test ./..." {
+			t.Fatalf("expected generate then test, got %v", commands)
+		}
+		logs := strings.Join(tk.MockLogger.Output(), "\n")
+		if !strings.Contains(logs, "DEFAULT: mod1:generate   ok") || !strings.Contains(logs, "DEFAULT: mod1:test       ok") {
+			t.Fatalf("expected the tasks to be named module:script, got %s", logs)
+		}
+	})
+	t.Run("should run the script of the upstream modules with ^", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/go.mod"] = []byte("module example.com/mod1\n")
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts]\nbuild = 'go build ./...'")
+		tk.MockFs.Files["/root/mod2/go.mod"] = []byte("module example.com/mod2\n\nrequire example.com/mod1 v0.0.0\n")
+		tk.MockFs.Files["/root/mod2/module.toml"] = []byte("[scripts.test]\nrun = 'go test ./...'\ndepends_on = ['^build']")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod2", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 2 || commands[0].Dir != "/root/mod1" || commands[0].Command != "go build ./..." || commands[1].Dir != "/root/mod2" {
+			t.Fatalf("expected build in mod1 then test in mod2, got %v", commands)
+		}
+	})
+	t.Run("should return an error for a cycle between scripts", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.generate]\nrun = 'go generate ./...'\ndepends_on = ['test']\n[scripts.test]\nrun = 'go test ./...'\ndepends_on = ['generate']")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "dependency cycle between scripts: mod1:test -> mod1:generate -> mod1:test" {
+			t.Fatalf("expected a cycle error, got %v", err)
+		}
+	})
+	t.Run("should return an error when a script depends on a missing script", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts.test]\nrun = 'go test ./...'\ndepends_on = ['generate']")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1", "test")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "script test depends on generate, which is missing in mod1" {
+			t.Fatalf("expected a missing script error, got %v", err)
+		}
+	})
+	t.Run("should append the arguments after -- to the script only", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/mod1/module.toml"] = []byte("[scripts]\ngenerate = 'go generate ./...'\n[scripts.test]\nrun = 'go test ./...'\ndepends_on = ['generate']")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1", "test", "--", "-run", "Test Foo", "it's")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 2 || commands[0].Command != "go generate ./..." || commands[1].Command != `go test ./... -run 'Test Foo' 'it'\''s'` {
+			t.Fatalf("expected the arguments to be quoted and appended to test, got %v", commands)
+		}
+	})
+	t.Run("should return an error for a flag after the script name", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags, "test", "--keep-going")
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "unexpected arguments after the script name: --keep-going, put the flags before the script name, or the arguments of the script after --" {
+			t.Fatalf("expected an unexpected arguments error, got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected no command to run")
+		}
+	})
+	t.Run("should export the variables of gorepo before the ones of the script", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/libs/mod3/module.toml"] = []byte("type = 'executable'\nmain = 'cmd/mod3'\n[scripts.test]\nrun = 'go test ./...'\nenv = { CGO_ENABLED = '0' }")
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod3", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"GOREPO_ROOT=/root",
+			"GOREPO_MONOREPO_NAME=my-monorepo",
+			"GOREPO_MONOREPO_VERSION=",
+			"GOREPO_MODULE_NAME=mod3",
+			"GOREPO_MODULE_PATH=libs/mod3",
+			"GOREPO_MODULE_TYPE=executable",
+			"GOREPO_MODULE_MAIN=cmd/mod3",
+			"GOREPO_SCRIPT=test",
+			"CGO_ENABLED=0",
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || !reflect.DeepEqual(commands[0].Env, expected) {
+			t.Fatalf("expected %v, got %v", expected, commands)
+		}
+	})
+	t.Run("should stop and report the modules running when interrupted", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockExec.Delays["/root/mod2"] = time.Minute
+		c, _ := NewMockContext(testExecuteFlags, "test")
+		ctx, cancel := context.WithCancelCause(context.Background())
+		c.Context = ctx
+		time.AfterFunc(10*time.Millisecond, func() {
+			cancel(&interruptError{Signal: syscall.SIGINT})
+		})
+		err := tk.cmd.Execute(c)
+		if err == nil || err.Error() != "interrupted in: mod2" {
+			t.Fatalf("expected 'interrupted in: mod2', got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 2 {
+			t.Fatalf("expected libs/mod3 not to run, got %v", tk.MockExec.Output())
+		}
+	})
+}
@@ -1 +1,39 @@
 package main
+
+import (
+	"testing"
+)
+
+func TestCommandFmtCI(t *testing.T) {
+	t.Run("should list the files that are not formatted", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockExec.Outputs["gofmt -l ."] = "main.go\ninternal/a.go\n"
+		c, _ := NewMockContext(testExecuteFlags, "--target=mod1")
+		err := tk.cmd.FmtCI(c)
+		if err == nil || err.Error() != "error: fmt-ci failed in module mod1, not formatted: main.go, internal/a.go" {
+			t.Fatalf("expected the files that are not formatted, got %v", err)
+		}
+	})
+	t.Run("should pass when gofmt lists no file", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		c, _ := NewMockContext(testExecuteFlags)
+		if err := tk.cmd.FmtCI(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockExec.Output()) != 3 {
+			t.Fatalf("expected 3 commands, got %d", len(tk.MockExec.Output()))
+		}
+	})
+	t.Run("should check the modules requiring a failed one with keep-going", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		tk.MockExec.Outputs["gofmt -l ."] = "main.go\n"
+		c, _ := NewMockContext(testExecuteFlags, "--keep-going", "--target=api,shared")
+		err := tk.cmd.FmtCI(c)
+		if err == nil || err.Error() != "failed in: shared, api" {
+			t.Fatalf("expected 'failed in: shared, api', got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 2 {
+			t.Fatalf("expected 2 commands, got %d", len(tk.MockExec.Output()))
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"strings"
+	"testing"
+)
+
+var testGraphFlags = []cli.Flag{
+	&cli.StringFlag{Name: "format", Value: "tree"},
+	&cli.StringFlag{Name: "focus"},
+}
+
+var testGraphFiles = map[string][]byte{
+	"/root/work.toml":          []byte("name = 'my-monorepo'"),
+	"/root/api/module.toml":    []byte(""),
+	"/root/api/go.mod":         []byte("module example.com/api\n\nrequire (\n\texample.com/shared v0.0.0\n\texample.com/auth v0.0.0\n)\n"),
+	"/root/auth/module.toml":   []byte(""),
+	"/root/auth/go.mod":        []byte("module example.com/auth\n\nrequire example.com/shared v0.0.0\n"),
+	"/root/shared/module.toml": []byte(""),
+	"/root/shared/go.mod":      []byte("module example.com/shared\n"),
+	"/root/tools/module.toml":  []byte(""),
+	"/root/tools/go.mod":       []byte("module example.com/tools\n"),
+}
+
+func graphOutput(tk *TestKit) string {
+	var lines []string
+	for _, line := range tk.MockLogger.Output() {
+		lines = append(lines, strings.TrimPrefix(line, "DEFAULT: "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCommandGraph(t *testing.T) {
+	t.Run("should render the graph as a tree", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		c, _ := NewMockContext(testGraphFlags)
+		if err := tk.cmd.Graph(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := "api\n├── auth\n│   └── shared\n└── shared\ntools"
+		if graphOutput(tk) != expected {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, graphOutput(tk))
+		}
+	})
+	t.Run("should only render the focused module and its relatives", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		c, _ := NewMockContext(testGraphFlags, "--format=dot", "--focus=auth")
+		if err := tk.cmd.Graph(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := "digraph modules {\n  \"api\" -> \"auth\";\n  \"api\" -> \"shared\";\n  \"auth\" -> \"shared\";\n  \"shared\";\n}"
+		if graphOutput(tk) != expected {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, graphOutput(tk))
+		}
+	})
+	t.Run("should render the graph as mermaid", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		c, _ := NewMockContext(testGraphFlags, "--format=mermaid", "--focus=shared")
+		if err := tk.cmd.Graph(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := "graph TD\n  m0[\"api\"]\n  m1[\"auth\"]\n  m2[\"shared\"]\n  m0 --> m1\n  m0 --> m2\n  m1 --> m2"
+		if graphOutput(tk) != expected {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, graphOutput(tk))
+		}
+	})
+	t.Run("should return an error for an unknown format", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		c, _ := NewMockContext(testGraphFlags, "--format=svg")
+		if err := tk.cmd.Graph(c); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
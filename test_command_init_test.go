@@ -46,6 +46,61 @@ func TestCommandInit(t *testing.T) {
 			t.Fatal("expected a non-nil value, got nil")
 		}
 	})
+	t.Run("should import existing modules with --import", func(t *testing.T) {
+		tk, _ := NewTestKit("/some/path/root", map[string][]byte{
+			"/some/path/root/go.work":                 []byte("go 1.22\n\nuse ./api\n"),
+			"/some/path/root/api/go.mod":              []byte("module example.com/api\n"),
+			"/some/path/root/api/main.go":             []byte("package main\n\nfunc main() {}\n"),
+			"/some/path/root/tools/go.mod":            []byte("module example.com/tools\n"),
+			"/some/path/root/tools/cmd/lint/main.go":  []byte("package main\n\nfunc main() {}\n"),
+			"/some/path/root/libs/shared/go.mod":      []byte("module example.com/shared\n"),
+			"/some/path/root/libs/shared/shared.go":   []byte("package shared\n"),
+			"/some/path/root/libs/shared/module.toml": []byte("type = 'library'\n"),
+			"/some/path/root/api/vendor/x/go.mod":     []byte("module x\n"),
+		}, map[string]bool{
+			"Do you want to vendor dependencies?":  true,
+			"Do you want to import these modules?": true,
+		}, map[string]string{
+			"What is the monorepo name?": "",
+		})
+		mockContext, _ := NewMockContext([]cli.Flag{&cli.BoolFlag{Name: "import"}}, "--import")
+		if err := tk.cmd.Init(mockContext); err != nil {
+			t.Fatal(err)
+		}
+		var api, tools ModuleConfig
+		_ = toml.Unmarshal(tk.MockFs.Files["/some/path/root/api/module.toml"], &api)
+		_ = toml.Unmarshal(tk.MockFs.Files["/some/path/root/tools/module.toml"], &tools)
+		if api.Type != "executable" || api.Main != "." {
+			t.Fatalf("expected api to be an executable with main '.', got %v", api)
+		}
+		if tools.Type != "executable" || tools.Main != "./cmd/lint" {
+			t.Fatalf("expected tools to be an executable with main './cmd/lint', got %v", tools)
+		}
+		if string(tk.MockFs.Files["/some/path/root/libs/shared/module.toml"]) != "type = 'library'\n" {
+			t.Fatal("expected the existing module.toml to be kept")
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Command != "go work use api libs/shared tools" {
+			t.Fatalf("expected all modules to be added to the workspace at once, got %v", commands)
+		}
+	})
+	t.Run("should not write anything if the import is not confirmed", func(t *testing.T) {
+		tk, _ := NewTestKit("/some/path/root", map[string][]byte{
+			"/some/path/root/api/go.mod": []byte("module example.com/api\n"),
+		}, map[string]bool{
+			"Do you want to vendor dependencies?":  true,
+			"Do you want to import these modules?": false,
+		}, map[string]string{
+			"What is the monorepo name?": "",
+		})
+		mockContext, _ := NewMockContext([]cli.Flag{&cli.BoolFlag{Name: "import"}}, "--import")
+		if err := tk.cmd.Init(mockContext); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockFs.Files) != 1 || len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected nothing to be written")
+		}
+	})
 	t.Run("should create a go.work file if it is missing", func(t *testing.T) {
 		// todo
 	})
@@ -1 +1,50 @@
 package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"reflect"
+	"testing"
+)
+
+var testListFlags = []cli.Flag{
+	&cli.BoolFlag{Name: "scripts"},
+}
+
+var testListFiles = map[string][]byte{
+	"/root/work.toml":        []byte("name = 'my-monorepo'\nstrategy = 'workspace'\n[scripts]\ngenerate = 'go generate ./...'"),
+	"/root/mod1/module.toml": []byte("[scripts]\nlint = 'golangci-lint run'\n[scripts.test]\nrun = 'go test ./...'\ndescription = 'Run the unit tests'"),
+	"/root/mod2/module.toml": []byte(""),
+}
+
+func TestCommandList(t *testing.T) {
+	t.Run("should list the modules", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testListFiles, nil)
+		c, _ := NewMockContext(testListFlags)
+		if err := tk.cmd.List(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"DEFAULT: mod1", "DEFAULT: mod2"}
+		if !reflect.DeepEqual(tk.MockLogger.Output(), expected) {
+			t.Fatalf("expected %v, got %v", expected, tk.MockLogger.Output())
+		}
+	})
+	t.Run("should list the scripts with their description", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testListFiles, nil)
+		c, _ := NewMockContext(testListFlags, "--scripts")
+		if err := tk.cmd.List(c); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"DEFAULT: root",
+			"DEFAULT:   generate",
+			"DEFAULT: mod1",
+			"DEFAULT:   lint",
+			"DEFAULT:   test         Run the unit tests",
+			"DEFAULT: mod2",
+			"DEFAULT:   no scripts",
+		}
+		if !reflect.DeepEqual(tk.MockLogger.Output(), expected) {
+			t.Fatalf("expected %v, got %q", expected, tk.MockLogger.Output())
+		}
+	})
+}
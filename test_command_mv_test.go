@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"testing"
+)
+
+var testMoveFlags = []cli.Flag{
+	&cli.StringFlag{Name: "module-path"},
+}
+
+var testMoveFiles = map[string][]byte{
+	"/root/work.toml":          []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+	"/root/go.work":            []byte("go 1.22\n\nuse (\n\t./api\n\t./shared\n)\n"),
+	"/root/api/module.toml":    []byte(""),
+	"/root/api/go.mod":         []byte("module example.com/api\n\nrequire (\n\texample.com/shared v0.0.0\n\texample.com/sharedutils v0.0.0\n)\n"),
+	"/root/api/main.go":        []byte("package main\n\nimport (\n\t\"fmt\"\n\n\tsh \"example.com/shared/pkg\"\n\t\"example.com/sharedutils\"\n)\n\nfunc main() { fmt.Println(sh.X, sharedutils.Y) }\n"),
+	"/root/shared/module.toml": []byte(""),
+	"/root/shared/go.mod":      []byte("module example.com/shared\n\ngo 1.22\n"),
+	"/root/shared/pkg/pkg.go":  []byte("package pkg\n\nimport \"example.com/shared/internal\"\n\nvar X = internal.X\n"),
+}
+
+func TestCommandMove(t *testing.T) {
+	t.Run("should move the module and update the workspace", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testMoveFiles, nil)
+		c, _ := NewMockContext(testMoveFlags, "shared", "libs/shared")
+		if err := tk.cmd.Move(c); err != nil {
+			t.Fatal(err)
+		}
+		if tk.MockFs.Files["/root/shared/go.mod"] != nil || tk.MockFs.Files["/root/libs/shared/go.mod"] == nil {
+			t.Fatal("expected the module to be moved to libs/shared")
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Command != "go work edit -dropuse=shared -use=libs/shared" {
+			t.Fatalf("expected the workspace to be updated, got %v", commands)
+		}
+		if string(tk.MockFs.Files["/root/api/go.mod"]) != "module example.com/api\n\nrequire (\n\texample.com/shared v0.0.0\n\texample.com/sharedutils v0.0.0\n)\n" {
+			t.Fatal("expected go.mod to be unchanged without --module-path")
+		}
+	})
+	t.Run("should rewrite go.mod and imports with a new module path", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testMoveFiles, nil)
+		c, _ := NewMockContext(testMoveFlags, "--module-path=example.com/libs/shared", "shared", "libs/shared")
+		if err := tk.cmd.Move(c); err != nil {
+			t.Fatal(err)
+		}
+		expectations := map[string]string{
+			"/root/libs/shared/go.mod":     "module example.com/libs/shared\n\ngo 1.22\n",
+			"/root/libs/shared/pkg/pkg.go": "package pkg\n\nimport \"example.com/libs/shared/internal\"\n\nvar X = internal.X\n",
+			"/root/api/go.mod":             "module example.com/api\n\nrequire (\n\texample.com/libs/shared v0.0.0\n\texample.com/sharedutils v0.0.0\n)\n",
+			"/root/api/main.go":            "package main\n\nimport (\n\t\"fmt\"\n\n\tsh \"example.com/libs/shared/pkg\"\n\t\"example.com/sharedutils\"\n)\n\nfunc main() { fmt.Println(sh.X, sharedutils.Y) }\n",
+		}
+		for file, expected := range expectations {
+			if string(tk.MockFs.Files[file]) != expected {
+				t.Fatalf("unexpected content for %s:\n%s", file, tk.MockFs.Files[file])
+			}
+		}
+	})
+	t.Run("should recompute the relative replace directives", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testMoveFiles, nil)
+		tk.MockFs.Files["/root/api/go.mod"] = []byte("module example.com/api\n\nreplace example.com/shared => ../shared // local\n")
+		tk.MockFs.Files["/root/shared/go.mod"] = []byte("module example.com/shared\n\nreplace (\n\texample.com/api v0.0.0 => ../api\n\texample.com/x => example.com/y v1.0.0\n)\n")
+		c, _ := NewMockContext(testMoveFlags, "shared", "libs/shared")
+		if err := tk.cmd.Move(c); err != nil {
+			t.Fatal(err)
+		}
+		expectations := map[string]string{
+			"/root/api/go.mod":         "module example.com/api\n\nreplace example.com/shared => ../libs/shared // local\n",
+			"/root/libs/shared/go.mod": "module example.com/shared\n\nreplace (\n\texample.com/api v0.0.0 => ../../api\n\texample.com/x => example.com/y v1.0.0\n)\n",
+		}
+		for file, expected := range expectations {
+			if string(tk.MockFs.Files[file]) != expected {
+				t.Fatalf("unexpected content for %s:\n%s", file, tk.MockFs.Files[file])
+			}
+		}
+	})
+	t.Run("should refuse to overwrite an existing folder", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testMoveFiles, nil)
+		c, _ := NewMockContext(testMoveFlags, "shared", "api")
+		if err := tk.cmd.Move(c); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
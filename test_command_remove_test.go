@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"strings"
+	"testing"
+)
+
+var testRemoveFlags = []cli.Flag{
+	&cli.BoolFlag{Name: "force"},
+	&cli.BoolFlag{Name: "archive"},
+}
+
+var testRemoveFiles = map[string][]byte{
+	"/root/work.toml":               []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+	"/root/go.work":                 []byte("go 1.22\n\nuse (\n\t./api\n\t./libs/shared\n)\n"),
+	"/root/api/module.toml":         []byte(""),
+	"/root/api/go.mod":              []byte("module example.com/api\n\nrequire example.com/shared v0.0.0\n"),
+	"/root/libs/shared/module.toml": []byte(""),
+	"/root/libs/shared/go.mod":      []byte("module example.com/shared\n"),
+	"/root/libs/shared/shared.go":   []byte("package shared\n"),
+}
+
+func TestCommandRemove(t *testing.T) {
+	t.Run("should refuse to remove a module required by other modules", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testRemoveFiles, map[string]bool{"Do you want to delete the folder libs/shared?": true})
+		c, _ := NewMockContext(testRemoveFlags, "shared")
+		err := tk.cmd.Remove(c)
+		if err == nil || err.Error() != "module shared is still required by: api (use --force to remove it anyway)" {
+			t.Fatalf("expected an error listing the dependents, got %v", err)
+		}
+		if tk.MockFs.Files["/root/libs/shared/go.mod"] == nil || len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected nothing to change")
+		}
+	})
+	t.Run("should drop the module from the workspace and delete it", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testRemoveFiles, map[string]bool{"Do you want to delete the folder libs/shared?": true})
+		c, _ := NewMockContext(testRemoveFlags, "--force", "shared")
+		if err := tk.cmd.Remove(c); err != nil {
+			t.Fatal(err)
+		}
+		commands := tk.MockExec.Output()
+		if len(commands) != 1 || commands[0].Command != "go work edit -dropuse=libs/shared" {
+			t.Fatalf("expected go work edit -dropuse=libs/shared, got %v", commands)
+		}
+		for file := range tk.MockFs.Files {
+			if strings.HasPrefix(file, "/root/libs/shared") {
+				t.Fatalf("expected %s to be deleted", file)
+			}
+		}
+	})
+	t.Run("should not delete anything if the user does not confirm", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testRemoveFiles, map[string]bool{"Do you want to delete the folder api?": false})
+		c, _ := NewMockContext(testRemoveFlags, "api")
+		if err := tk.cmd.Remove(c); err != nil {
+			t.Fatal(err)
+		}
+		if tk.MockFs.Files["/root/api/go.mod"] == nil || len(tk.MockExec.Output()) != 0 {
+			t.Fatal("expected nothing to change")
+		}
+	})
+	t.Run("should archive the module instead of deleting it", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testRemoveFiles, nil)
+		c, _ := NewMockContext(testRemoveFlags, "--archive", "api")
+		if err := tk.cmd.Remove(c); err != nil {
+			t.Fatal(err)
+		}
+		archived := false
+		for file := range tk.MockFs.Files {
+			if strings.HasPrefix(file, "/root/.gorepo/archive/api-") && strings.HasSuffix(file, "/go.mod") {
+				archived = true
+			}
+		}
+		if !archived || tk.MockFs.Files["/root/api/go.mod"] != nil {
+			t.Fatal("expected the module to be moved to the archive")
+		}
+	})
+}
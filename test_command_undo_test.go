@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+var testUndoFiles = map[string][]byte{
+	"/root/work.toml":          []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+	"/root/go.work":            []byte("go 1.22\n\nuse ./mod1\n"),
+	"/root/mod1/module.toml":   []byte(""),
+	"/root/mod1/go.mod":        []byte("module mod1\n"),
+	"/root/mod1/main.go":       []byte("package main\n"),
+	"/root/mod1/internal/a.go": []byte("package internal\n"),
+}
+
+func TestCommandUndo(t *testing.T) {
+	t.Run("should roll back the changes of a failing command", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testUndoFiles, nil)
+		tk.MockExec.Errors["/root"] = errors.New("go work use failed")
+		c, _ := NewMockContext(nil, "libs/mod2")
+		err := tk.cmd.transaction("add", tk.cmd.Add)(c)
+		if err == nil || err.Error() != "go work use failed" {
+			t.Fatalf("expected 'go work use failed', got %v", err)
+		}
+		if tk.MockFs.Exists("/root/libs/mod2/module.toml") {
+			t.Fatal("expected module.toml to be rolled back")
+		}
+		if tk.MockFs.Exists("/root/.gorepo/journal/journal.json") {
+			t.Fatal("expected no journal to be kept")
+		}
+	})
+	t.Run("should revert the last command", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testUndoFiles, map[string]bool{
+			"Do you want to revert these changes?": true,
+		})
+		c, _ := NewMockContext(nil, "libs/mod2")
+		if err := tk.cmd.transaction("add", tk.cmd.Add)(c); err != nil {
+			t.Fatal(err)
+		}
+		if !tk.MockFs.Exists("/root/libs/mod2/module.toml") {
+			t.Fatal("expected module.toml to be written")
+		}
+		c, _ = NewMockContext(nil)
+		if err := tk.cmd.Undo(c); err != nil {
+			t.Fatal(err)
+		}
+		if tk.MockFs.Exists("/root/libs") || tk.MockFs.Exists("/root/.gorepo") {
+			t.Fatalf("expected the module and the journal to be deleted, got %v", tk.MockFs.Output())
+		}
+	})
+	t.Run("should restore a removed module from the trash", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testUndoFiles, map[string]bool{
+			"Do you want to delete the folder mod1?": true,
+			"Do you want to revert these changes?":   true,
+		})
+		c, _ := NewMockContext(testRemoveFlags, "mod1")
+		if err := tk.cmd.transaction("remove", tk.cmd.Remove)(c); err != nil {
+			t.Fatal(err)
+		}
+		if tk.MockFs.Exists("/root/mod1") {
+			t.Fatal("expected mod1 to be removed")
+		}
+		modules, _ := tk.cfg.GetModules([]string{"all"}, []string{}, false)
+		if len(modules) != 0 {
+			t.Fatalf("expected the trash to be ignored, got %v", modules)
+		}
+		c, _ = NewMockContext(nil)
+		if err := tk.cmd.Undo(c); err != nil {
+			t.Fatal(err)
+		}
+		if string(tk.MockFs.Files["/root/mod1/internal/a.go"]) != "package internal\n" {
+			t.Fatalf("expected mod1 to be restored, got %v", tk.MockFs.Output())
+		}
+	})
+	t.Run("should return an error when there is nothing to undo", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testUndoFiles, nil)
+		c, _ := NewMockContext(nil)
+		if err := tk.cmd.Undo(c); err == nil || err.Error() != "nothing to undo" {
+			t.Fatalf("expected 'nothing to undo', got %v", err)
+		}
+	})
+}
@@ -1 +1,22 @@
 package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommandVetCI(t *testing.T) {
+	t.Run("should check the modules requiring a failed one with keep-going", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testGraphFiles, nil)
+		tk.MockExec.Errors["/root/shared"] = errors.New("exit status 1")
+		tk.MockExec.Errors["/root/api"] = errors.New("exit status 1")
+		c, _ := NewMockContext(testExecuteFlags, "--keep-going", "--target=api,shared")
+		err := tk.cmd.VetCI(c)
+		if err == nil || err.Error() != "failed in: shared, api" {
+			t.Fatalf("expected 'failed in: shared, api', got %v", err)
+		}
+		if len(tk.MockExec.Output()) != 2 {
+			t.Fatalf("expected 2 commands, got %d", len(tk.MockExec.Output()))
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newMockCacheServer starts a server implementing the remote cache protocol
+func newMockCacheServer(t *testing.T, token string) (server *httptest.Server, entries map[string][]byte) {
+	var mu sync.Mutex
+	entries = map[string][]byte{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/cache/")
+		switch r.Method {
+		case http.MethodGet:
+			if content, ok := entries[key]; ok {
+				_, _ = w.Write(content)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			entries[key], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, entries
+}
+
+func TestConfigCache(t *testing.T) {
+	t.Run("should write entries to the local and the remote cache", func(t *testing.T) {
+		server, entries := newMockCacheServer(t, "secret")
+		tk, _ := NewTestKit("/root", map[string][]byte{
+			"/root/work.toml": []byte("name = 'my-monorepo'\n[cache]\nurl = '" + server.URL + "/cache/'\ntoken_env = 'CACHE_TOKEN'"),
+		}, nil, nil)
+		tk.MockOs.Env = map[string]string{"CACHE_TOKEN": "secret"}
+		if err := tk.cfg.WriteCache("abc", CacheEntry{Module: "mod1", Script: "test", Output: "ok\n"}); err != nil {
+			t.Fatal(err)
+		}
+		if tk.MockFs.Files["/root/.gorepo/cache/abc.json"] == nil {
+			t.Fatal("expected the entry in the local cache")
+		}
+		if entries["abc"] == nil {
+			t.Fatal("expected the entry in the remote cache")
+		}
+	})
+	t.Run("should read entries from the remote cache and copy them locally", func(t *testing.T) {
+		server, entries := newMockCacheServer(t, "")
+		entries["abc"] = []byte(`{"module":"mod1","script":"test","output":"ok\n"}`)
+		tk, _ := NewTestKit("/root", map[string][]byte{
+			"/root/work.toml": []byte("name = 'my-monorepo'\n[cache]\nurl = '" + server.URL + "/cache'"),
+		}, nil, nil)
+		entry, found, err := tk.cfg.ReadCache("abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || entry.Output != "ok\n" {
+			t.Fatalf("expected a cache hit, got %v", entry)
+		}
+		if tk.MockFs.Files["/root/.gorepo/cache/abc.json"] == nil {
+			t.Fatal("expected the entry to be copied in the local cache")
+		}
+		if _, found, _ := tk.cfg.ReadCache("def"); found {
+			t.Fatal("expected a cache miss")
+		}
+	})
+	t.Run("should handle remote errors as a cache miss", func(t *testing.T) {
+		server, _ := newMockCacheServer(t, "secret")
+		tk, _ := NewTestKit("/root", map[string][]byte{
+			"/root/work.toml": []byte("name = 'my-monorepo'\n[cache]\nurl = '" + server.URL + "/cache'"),
+		}, nil, nil)
+		if _, found, err := tk.cfg.ReadCache("abc"); err != nil || found {
+			t.Fatalf("expected a cache miss, got %v %v", found, err)
+		}
+		if logs := tk.MockLogger.Output(); len(logs) != 1 || !strings.HasPrefix(logs[0], "WARNING: failed to read remote cache") {
+			t.Fatalf("expected a warning, got %v", logs)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfigFilterAffectedModules(t *testing.T) {
+	files := map[string][]byte{
+		"/root/work.toml":               []byte("name = 'my-monorepo'"),
+		"/root/api/module.toml":         []byte(""),
+		"/root/api/go.mod":              []byte("module example.com/api\n\nrequire example.com/shared v0.0.0\n"),
+		"/root/cli/module.toml":         []byte(""),
+		"/root/cli/go.mod":              []byte("module example.com/cli\n"),
+		"/root/libs/shared/module.toml": []byte(""),
+		"/root/libs/shared/go.mod":      []byte("module example.com/shared\n"),
+	}
+	t.Run("should keep changed modules and their dependents", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		tk.MockExec.Outputs["git merge-base HEAD main"] = "abc123\n"
+		tk.MockExec.Outputs["git diff --name-only -z --relative abc123"] = "libs/shared/shared.go\x00README.md\x00"
+		modules, _ := tk.cfg.GetModules([]string{"all"}, []string{}, false)
+		affected, err := tk.cfg.FilterAffectedModules(context.Background(), modules, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(affected) != 2 || affected[0].Name != "api" || affected[1].Name != "shared" {
+			t.Fatalf("expected api and shared, got %v", affected)
+		}
+	})
+	t.Run("should compare with the given ref and include untracked files", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		tk.MockExec.Outputs["git ls-files -z --others --exclude-standard"] = "cli/new.go\x00"
+		modules, _ := tk.cfg.GetModules([]string{"all"}, []string{}, false)
+		affected, err := tk.cfg.FilterAffectedModules(context.Background(), modules, "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(affected) != 1 || affected[0].Name != "cli" {
+			t.Fatalf("expected cli, got %v", affected)
+		}
+		if tk.MockExec.Output()[0].Command != "git diff --name-only -z --relative v1.0.0" {
+			t.Fatalf("expected a diff against v1.0.0, got %s", tk.MockExec.Output()[0].Command)
+		}
+	})
+	t.Run("should read paths with spaces and non-ASCII characters", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		tk.MockExec.Outputs["git diff --name-only -z --relative v1.0.0"] = "README.md\x00libs/shared/my données.go\x00"
+		modules, _ := tk.cfg.GetModules([]string{"all"}, []string{}, false)
+		affected, err := tk.cfg.FilterAffectedModules(context.Background(), modules, "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(affected) != 2 || affected[0].Name != "api" || affected[1].Name != "shared" {
+			t.Fatalf("expected api and shared, got %v", affected)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigGetModuleGraph(t *testing.T) {
+	files := map[string][]byte{
+		"/root/work.toml":               []byte("name = 'my-monorepo'"),
+		"/root/api/module.toml":         []byte(""),
+		"/root/api/go.mod":              []byte("module example.com/api\n\nrequire (\n\texample.com/shared v0.0.0 // local\n\tgithub.com/fatih/color v1.18.0\n)\n"),
+		"/root/cli/module.toml":         []byte(""),
+		"/root/cli/go.mod":              []byte("module example.com/cli\n\nrequire example.com/api v0.0.0\n"),
+		"/root/libs/shared/module.toml": []byte(""),
+		"/root/libs/shared/go.mod":      []byte("module example.com/shared\n"),
+	}
+	t.Run("should find the local requirements of every module", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		graph, err := tk.cfg.GetModuleGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(graph.Deps["api"], []string{"libs/shared"}) {
+			t.Fatalf("expected api to require libs/shared, got %v", graph.Deps["api"])
+		}
+		if graph.ModulePaths["cli"] != "example.com/cli" {
+			t.Fatalf("expected example.com/cli, got %s", graph.ModulePaths["cli"])
+		}
+	})
+	t.Run("should sort modules with their dependencies first", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		graph, _ := tk.cfg.GetModuleGraph()
+		modules, _ := tk.cfg.GetModules([]string{"cli", "shared"}, []string{}, false)
+		sorted, deps, err := graph.Sort(modules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sorted[0].Name != "shared" || sorted[1].Name != "cli" {
+			t.Fatalf("expected shared then cli, got %s then %s", sorted[0].Name, sorted[1].Name)
+		}
+		if !reflect.DeepEqual(deps, [][]int{nil, {0}}) {
+			t.Fatalf("expected cli to depend on shared through api, got %v", deps)
+		}
+	})
+	t.Run("should report cycles with their full path", func(t *testing.T) {
+		cyclic := map[string][]byte{}
+		for k, v := range files {
+			cyclic[k] = v
+		}
+		cyclic["/root/libs/shared/go.mod"] = []byte("module example.com/shared\n\nrequire example.com/cli v0.0.0\n")
+		tk, _ := NewTestKit("/root", cyclic, nil, nil)
+		graph, _ := tk.cfg.GetModuleGraph()
+		_, _, err := graph.Sort(graph.Modules)
+		if err == nil || err.Error() != "dependency cycle between modules: api -> shared -> cli -> api" {
+			t.Fatalf("expected a cycle error, got %v", err)
+		}
+	})
+}
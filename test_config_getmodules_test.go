@@ -1 +1,99 @@
 package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigGetModules(t *testing.T) {
+	files := map[string][]byte{
+		"/root/work.toml":                []byte("name = 'my-monorepo'"),
+		"/root/services/api/module.toml": []byte("type = 'executable'\ntags = ['backend', 'grpc']"),
+		"/root/services/api/go.mod":      []byte("module example.com/api\n\nrequire example.com/shared v0.0.0\n"),
+		"/root/services/web/module.toml": []byte("type = 'executable'\ntags = ['frontend']"),
+		"/root/services/web/go.mod":      []byte("module example.com/web\n"),
+		"/root/libs/shared/module.toml":  []byte("type = 'library'\ntags = ['backend']"),
+		"/root/libs/shared/go.mod":       []byte("module example.com/shared\n"),
+	}
+	names := func(modules []ModuleConfig) (names []string) {
+		for _, module := range modules {
+			names = append(names, module.Name)
+		}
+		return names
+	}
+	tests := []struct {
+		name     string
+		targets  []string
+		exclude  []string
+		expected []string
+	}{
+		{"should target every module with all", []string{"all"}, []string{}, []string{"api", "shared", "web"}},
+		{"should target modules by name", []string{"web", "api"}, []string{}, []string{"api", "web"}},
+		{"should target modules by glob", []string{"*a*"}, []string{}, []string{"api", "shared"}},
+		{"should target modules by tag", []string{"tag:backend"}, []string{}, []string{"api", "shared"}},
+		{"should target modules by path", []string{"path:services/*"}, []string{}, []string{"api", "web"}},
+		{"should target modules by type", []string{"type:library"}, []string{}, []string{"shared"}},
+		{"should target the dependencies of a module", []string{"deps-of:api"}, []string{}, []string{"shared"}},
+		{"should target the dependents of a module", []string{"dependents-of:shared"}, []string{}, []string{"api"}},
+		{"should intersect selectors joined with +", []string{"tag:backend+type:executable"}, []string{}, []string{"api"}},
+		{"should unite selectors", []string{"tag:frontend", "type:library"}, []string{}, []string{"shared", "web"}},
+		{"should exclude modules with selectors", []string{"all"}, []string{"tag:backend"}, []string{"web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk, _ := NewTestKit("/root", files, nil, nil)
+			modules, err := tk.cfg.GetModules(tt.targets, tt.exclude, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names(modules), tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, names(modules))
+			}
+		})
+	}
+	t.Run("should return an error with suggestions for an unknown target", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		_, err := tk.cfg.GetModules([]string{"shard", "tag:backnd"}, []string{}, false)
+		expected := "unknown target 'shard', did you mean 'shared'?\nunknown target 'tag:backnd', did you mean 'tag:backend'?"
+		if err == nil || err.Error() != expected {
+			t.Fatalf("expected %q, got %v", expected, err)
+		}
+	})
+	t.Run("should return an error for a tag that no module has", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", map[string][]byte{
+			"/root/work.toml":       []byte("name = 'my-monorepo'"),
+			"/root/api/module.toml": []byte(""),
+		}, nil, nil)
+		_, err := tk.cfg.GetModules([]string{"tag:backend"}, []string{}, false)
+		if err == nil || err.Error() != "unknown target 'tag:backend'" {
+			t.Fatalf("expected an unknown target error, got %v", err)
+		}
+	})
+	t.Run("should only warn for an unknown exclude", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		modules, err := tk.cfg.GetModules([]string{"all"}, []string{"apii"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(modules) != 3 {
+			t.Fatalf("expected 3 modules, got %d", len(modules))
+		}
+		if logs := tk.MockLogger.Output(); len(logs) != 1 || logs[0] != "WARNING: unknown exclude 'apii', did you mean 'api'?" {
+			t.Fatalf("expected a warning, got %v", logs)
+		}
+	})
+	t.Run("should return an error for an unknown exclude when strict", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		_, err := tk.cfg.GetModules([]string{"all"}, []string{"apii"}, true)
+		if err == nil || err.Error() != "unknown exclude 'apii', did you mean 'api'?" {
+			t.Fatalf("expected an unknown exclude error, got %v", err)
+		}
+	})
+	t.Run("should return an error for an unknown selector kind", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", files, nil, nil)
+		_, err := tk.cfg.GetModules([]string{"owner:me"}, []string{}, false)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+var testInterpolationFiles = map[string][]byte{
+	"/root/work.toml": []byte("name = 'my-monorepo'\nversion = '1.2.0'\n[vars]\nregistry = 'ghcr.io/${root.name}'\nowner = 'platform'"),
+}
+
+func TestConfigLoadModuleConfig(t *testing.T) {
+	t.Run("should expand the variables in scripts and other fields", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testInterpolationFiles, nil)
+		tk.MockFs.Files["/root/services/api/module.toml"] = []byte("main = 'cmd/${module.name}'\n" +
+			"[vars]\nimage = '${vars.registry}/${module.name}:${root.version}'\nowner = 'api-team'\n" +
+			"[scripts]\nbuild = 'GOOS=${env.GOOS} go build -o bin/${module.path} ./${vars.owner}'\n" +
+			"[scripts.push]\nrun = 'docker push ${vars.image}'\ndescription = 'Push ${vars.image}'")
+		tk.MockOs.Env = map[string]string{"GOOS": "linux"}
+		cfg, err := tk.cfg.LoadModuleConfig("services/api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Main != "cmd/api" {
+			t.Fatalf("expected 'cmd/api', got %s", cfg.Main)
+		}
+		if cfg.Scripts["build"].Run != "GOOS=linux go build -o bin/services/api ./api-team" {
+			t.Fatalf("unexpected build script %s", cfg.Scripts["build"].Run)
+		}
+		if cfg.Scripts["push"].Run != "docker push ghcr.io/my-monorepo/api:1.2.0" || cfg.Scripts["push"].Description != "Push ghcr.io/my-monorepo/api:1.2.0" {
+			t.Fatalf("unexpected push script %v", cfg.Scripts["push"])
+		}
+	})
+	t.Run("should leave the other variables to the shell", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testInterpolationFiles, nil)
+		tk.MockFs.Files["/root/services/api/module.toml"] = []byte("[scripts]\ntest = 'echo ${HOME} $${module.name}'")
+		cfg, err := tk.cfg.LoadModuleConfig("services/api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Scripts["test"].Run != "echo ${HOME} ${module.name}" {
+			t.Fatalf("expected 'echo ${HOME} ${module.name}', got %s", cfg.Scripts["test"].Run)
+		}
+	})
+	t.Run("should return an error naming the file and the key of an undefined variable", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testInterpolationFiles, nil)
+		tk.MockFs.Files["/root/services/api/module.toml"] = []byte("[scripts.test]\nrun = 'go test ./...'\nenv = { TOKEN = '${env.TOKEN}' }")
+		_, err := tk.cfg.LoadModuleConfig("services/api")
+		if err == nil || err.Error() != "services/api/module.toml: undefined variable ${env.TOKEN} in scripts.test.env.TOKEN" {
+			t.Fatalf("expected an undefined variable error, got %v", err)
+		}
+	})
+	t.Run("should return an error for a module variable in work.toml", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testInterpolationFiles, nil)
+		tk.MockFs.Files["/root/work.toml"] = []byte("name = 'my-monorepo'\n[scripts]\nbuild = 'echo ${module.name}'")
+		_, err := tk.cfg.LoadRootConfig()
+		if err == nil || err.Error() != "work.toml: undefined variable ${module.name} in scripts.build" {
+			t.Fatalf("expected an undefined variable error, got %v", err)
+		}
+	})
+}
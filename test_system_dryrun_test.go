@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSystemDryRun(t *testing.T) {
+	t.Run("should only log the plan of gorepo add", func(t *testing.T) {
+		tk, _ := NewTestKit("/root", map[string][]byte{
+			"/root/work.toml": []byte("name = 'my-monorepo'\nstrategy = 'workspace'"),
+		}, nil, nil)
+		tk.su.Fs = NewDryRunFs(tk.MockFs, tk.MockLogger)
+		tk.su.Exec = NewDryRunExec(tk.MockExec, tk.MockLogger)
+		c, _ := NewMockContext(nil, "libs/mod1")
+		if err := tk.cmd.Add(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockFs.Output()) != 1 {
+			t.Fatalf("expected no file to be written, got %v", tk.MockFs.Output())
+		}
+		if len(tk.MockExec.Output()) != 0 {
+			t.Fatalf("expected no command to run, got %v", tk.MockExec.Output())
+		}
+		var plan []string
+		for _, msg := range tk.MockLogger.Output() {
+			if len(msg) > 6 && msg[:6] == "INFO: " {
+				plan = append(plan, msg[6:])
+			}
+		}
+		expected := []string{
+			"dry run: would create directory /root/libs/mod1",
+			"dry run: would write /root/libs/mod1/module.toml",
+			"dry run: would run 'go mod init mod1' in /root/libs/mod1",
+			"dry run: would run 'go work use libs/mod1' in /root",
+		}
+		if !reflect.DeepEqual(plan, expected) {
+			t.Fatalf("expected %v, got %v", expected, plan)
+		}
+	})
+	t.Run("should only log the plan of gorepo mv with a new module path", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testMoveFiles, nil)
+		before := len(tk.MockFs.Output())
+		tk.su.Fs = NewDryRunFs(tk.MockFs, tk.MockLogger)
+		tk.su.Exec = NewDryRunExec(tk.MockExec, tk.MockLogger)
+		c, _ := NewMockContext(testMoveFlags, "--module-path=example.com/libs/shared", "shared", "libs/shared")
+		if err := tk.cmd.Move(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockFs.Output()) != before || tk.MockFs.Files["/root/shared/go.mod"] == nil {
+			t.Fatalf("expected no file to be changed, got %v", tk.MockFs.Output())
+		}
+		var plan []string
+		for _, msg := range tk.MockLogger.Output() {
+			if len(msg) > 6 && msg[:6] == "INFO: " {
+				plan = append(plan, msg[6:])
+			}
+		}
+		expected := []string{
+			"dry run: would create directory /root/libs",
+			"dry run: would move /root/shared to /root/libs/shared",
+			"dry run: would write /root/api/go.mod",
+			"dry run: would write /root/api/main.go",
+			"dry run: would write /root/libs/shared/go.mod",
+			"dry run: would write /root/libs/shared/pkg/pkg.go",
+			"dry run: would run 'go work edit -dropuse=shared -use=libs/shared' in /root",
+		}
+		if !reflect.DeepEqual(plan, expected) {
+			t.Fatalf("expected %v, got %v", expected, plan)
+		}
+	})
+	t.Run("should not journal the changes of a transaction", func(t *testing.T) {
+		tk, _ := NewMonorepoTestKit(testRemoveFiles, map[string]bool{"Do you want to delete the folder libs/shared?": true})
+		tk.su.Fs = NewDryRunFs(tk.MockFs, tk.MockLogger)
+		tk.su.Exec = NewDryRunExec(tk.MockExec, tk.MockLogger)
+		c, _ := NewMockContext(append([]cli.Flag{&cli.BoolFlag{Name: "dry-run"}}, testRemoveFlags...), "--dry-run", "--force", "shared")
+		if err := tk.cmd.transaction("remove", tk.cmd.Remove)(c); err != nil {
+			t.Fatal(err)
+		}
+		logs := strings.Join(tk.MockLogger.Output(), "\n")
+		if !strings.Contains(logs, "INFO: dry run: would remove /root/libs/shared") || strings.Contains(logs, "journal") {
+			t.Fatalf("expected the module to be removed without journal, got %s", logs)
+		}
+	})
+	t.Run("should read the files written during the run", func(t *testing.T) {
+		fs := NewDryRunFs(NewMockFs(map[string][]byte{"/root/a": []byte("a")}), NewMockLogger())
+		_ = fs.Write("/root/b", []byte("b"))
+		_ = fs.RemoveAll("/root/a")
+		if !fs.Exists("/root/b") || fs.Exists("/root/a") {
+			t.Fatal("expected /root/b to exist and /root/a to be removed")
+		}
+		if content, _ := fs.Read("/root/b"); string(content) != "b" {
+			t.Fatalf("expected 'b', got %s", content)
+		}
+	})
+	t.Run("should not cache the scripts that did not run", func(t *testing.T) {
+		server, entries := newMockCacheServer(t, "")
+		workToml := []byte("name = 'my-monorepo'\nstrategy = 'workspace'\n[cache]\nurl = '" + server.URL + "/cache'")
+		flags := append([]cli.Flag{&cli.BoolFlag{Name: "dry-run"}}, testExecuteFlags...)
+		tk, _ := NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/work.toml"] = workToml
+		tk.su.Fs = NewDryRunFs(tk.MockFs, tk.MockLogger)
+		tk.su.Exec = NewDryRunExec(tk.MockExec, tk.MockLogger)
+		c, _ := NewMockContext(flags, "--dry-run", "--cache", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("expected nothing in the remote cache, got %v", entries)
+		}
+		// a real run, on another machine sharing the remote cache
+		tk, _ = NewMonorepoTestKit(testExecuteFiles, nil)
+		tk.MockFs.Files["/root/work.toml"] = workToml
+		c, _ = NewMockContext(flags, "--cache", "test")
+		if err := tk.cmd.Execute(c); err != nil {
+			t.Fatal(err)
+		}
+		if len(tk.MockExec.Output()) != 3 {
+			t.Fatalf("expected the scripts to run after the dry run, got %v", tk.MockExec.Output())
+		}
+	})
+}
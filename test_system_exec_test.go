@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// alive tells if a process is running, a zombie waiting to be reaped is not
+func alive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	return err != nil || !strings.Contains(string(stat), ") Z ")
+}
+
+// waitGone waits for processes to stop, and returns the ones still running after a second
+func waitGone(pids ...int) (running []int) {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		running = running[:0]
+		for _, pid := range pids {
+			if alive(pid) {
+				running = append(running, pid)
+			}
+		}
+		if len(running) == 0 || time.Now().After(deadline) {
+			return running
+		}
+	}
+}
+
+// readPids reads the pids a script wrote to a file, one per line
+func readPids(t *testing.T, path string) (pids []int) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// waitPids waits for a script to write its pids to a file, and reads them
+func waitPids(t *testing.T, path string) (pids []int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if content, err := os.ReadFile(path); err == nil && strings.HasSuffix(string(content), "\n") {
+			return readPids(t, path)
+		}
+	}
+	t.Fatal("the script did not start")
+	return nil
+}
+
+func TestSystemExec(t *testing.T) {
+	t.Run("should kill the process group of a script that times out", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := (&Exec{}).BashCommand(ctx, dir, "sleep 300 & echo $$ $! > pids; wait", ExecOptions{})
+		if err == nil {
+			t.Fatal("expected the script to be killed")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the script to stop at the timeout, took %s", elapsed)
+		}
+		if running := waitGone(readPids(t, filepath.Join(dir, "pids"))...); len(running) > 0 {
+			t.Fatalf("expected the process group to be gone, still running %v", running)
+		}
+	})
+	t.Run("should forward the signal to a script and let it stop", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			script := "trap 'echo stopped > out; exit 0' TERM; sleep 300 & echo $$ $! > pids; wait"
+			_, _ = (&Exec{}).BashCommand(ctx, dir, script, ExecOptions{})
+		}()
+		pids := waitPids(t, filepath.Join(dir, "pids"))
+		start := time.Now()
+		cancel(&interruptError{Signal: syscall.SIGTERM})
+		<-done
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the script to stop on the signal, took %s", elapsed)
+		}
+		if content, err := os.ReadFile(filepath.Join(dir, "out")); err != nil || string(content) != "stopped\n" {
+			t.Fatalf("expected the trap of the script to run, got %q, %v", content, err)
+		}
+		if running := waitGone(pids...); len(running) > 0 {
+			t.Fatalf("expected the process group to be gone, still running %v", running)
+		}
+	})
+	t.Run("should kill a script that ignores the signal after the grace period", func(t *testing.T) {
+		gracePeriod := interruptGracePeriod
+		interruptGracePeriod = 500 * time.Millisecond
+		defer func() { interruptGracePeriod = gracePeriod }()
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = (&Exec{}).BashCommand(ctx, dir, "trap '' TERM; sleep 300 & echo $$ $! > pids; wait", ExecOptions{})
+		}()
+		pids := waitPids(t, filepath.Join(dir, "pids"))
+		start := time.Now()
+		cancel(&interruptError{Signal: syscall.SIGTERM})
+		<-done
+		if elapsed := time.Since(start); elapsed < interruptGracePeriod || elapsed > 5*time.Second {
+			t.Fatalf("expected the script to be killed after %s, took %s", interruptGracePeriod, elapsed)
+		}
+		if running := waitGone(pids...); len(running) > 0 {
+			t.Fatalf("expected the process group to be killed, still running %v", running)
+		}
+	})
+}
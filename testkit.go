@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"github.com/urfave/cli/v2"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,6 +27,20 @@ type TestKit struct {
 	cmd        *Commands
 }
 
+// NewMockContext returns a cli context with the given flags parsed from args
+func NewMockContext(flags []cli.Flag, args ...string) (*cli.Context, error) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			return nil, err
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+	return cli.NewContext(&cli.App{Name: "test-app"}, set, nil), nil
+}
+
 // NewTestKit creates a new TestKit
 // wd: working directory from where the command is executed
 // files: map of files with their content (pass nil if not needed)
@@ -48,6 +67,17 @@ func NewTestKit(wd string, files map[string][]byte, qABool map[string]bool, qaSt
 	}, nil
 }
 
+// NewMonorepoTestKit creates a new TestKit working from /root, the root of the monorepo
+// files: map of files with their content, copied so that the tests of a file can share them
+// qABool: map of questions and answers for boolean questions (pass nil if not needed)
+func NewMonorepoTestKit(files map[string][]byte, qABool map[string]bool) (tk *TestKit, err error) {
+	copied := make(map[string][]byte, len(files))
+	for path, content := range files {
+		copied[path] = content
+	}
+	return NewTestKit("/root", copied, qABool, nil)
+}
+
 type MockFs struct {
 	Files map[string][]byte
 }
@@ -59,8 +89,16 @@ func NewMockFs(files map[string][]byte) *MockFs {
 }
 
 func (m MockFs) Exists(path string) bool {
-	_, exists := m.Files[path]
-	return exists
+	if _, exists := m.Files[path]; exists {
+		return true
+	}
+	// a directory exists if it contains files
+	for file := range m.Files {
+		if strings.HasPrefix(file, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
 
 func (m MockFs) Read(path string) ([]byte, error) {
@@ -75,6 +113,33 @@ func (m MockFs) Write(path string, content []byte) error {
 	return nil
 }
 
+func (m MockFs) MkdirAll(path string) error {
+	return nil
+}
+
+func (m MockFs) RemoveAll(path string) error {
+	for file := range m.Files {
+		if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+			delete(m.Files, file)
+		}
+	}
+	return nil
+}
+
+func (m MockFs) Rename(oldPath, newPath string) error {
+	moved := map[string][]byte{}
+	for file, content := range m.Files {
+		if file == oldPath || strings.HasPrefix(file, oldPath+string(filepath.Separator)) {
+			delete(m.Files, file)
+			moved[newPath+strings.TrimPrefix(file, oldPath)] = content
+		}
+	}
+	for file, content := range moved {
+		m.Files[file] = content
+	}
+	return nil
+}
+
 func (m MockFs) Walk(root string, walkFn filepath.WalkFunc) error {
 	// Collect all directories and files beneath `root`.
 	dirs := make(map[string]bool)
@@ -86,13 +151,15 @@ func (m MockFs) Walk(root string, walkFn filepath.WalkFunc) error {
 
 	for path := range m.Files {
 		// Only consider files that are within the root directory
-		if !strings.HasPrefix(filepath.Clean(path), root) {
+		if !strings.HasPrefix(filepath.Clean(path), strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
 			continue
 		}
 
 		dir := filepath.Dir(path)
-		dirs[dir] = true
 		filesInDir[dir] = append(filesInDir[dir], path)
+		for ; dir != root && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
 	}
 
 	// Convert map to slice to have a stable order
@@ -105,7 +172,11 @@ func (m MockFs) Walk(root string, walkFn filepath.WalkFunc) error {
 	dirList = sortByPathLength(dirList)
 
 	// Walk directories, then files
+	var skipped []string
 	for _, d := range dirList {
+		if isInDirs(d, skipped) {
+			continue
+		}
 		// WalkFn for directory itself
 		dInfo := mockFileInfo{
 			name:  filepath.Base(d),
@@ -119,6 +190,7 @@ func (m MockFs) Walk(root string, walkFn filepath.WalkFunc) error {
 		if err != nil {
 			if err == filepath.SkipDir {
 				// Skip this directory and its contents
+				skipped = append(skipped, d)
 				continue
 			}
 			return err
@@ -146,6 +218,16 @@ func (m MockFs) Walk(root string, walkFn filepath.WalkFunc) error {
 	return nil
 }
 
+// isInDirs tells if a path is inside one of the directories
+func isInDirs(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // Helper function to sort by path length so that shorter directories
 // (closer to root) come first. This ensures we walk parent directories
 // before children, mimicking the behavior of filepath.Walk.
@@ -192,49 +274,103 @@ func (m MockFs) Output() map[string][]byte {
 /////////////////////////////////////////////////////////////////
 
 type MockExec struct {
+	mu       sync.Mutex
 	Commands []MockCommand
+	// Errors maps a directory to the error returned by commands run in it
+	Errors map[string]error
+	// Outputs maps a command to the output it returns
+	Outputs map[string]string
+	// Delays maps a directory to the time commands run in it take, unless their context is done
+	Delays map[string]time.Duration
 }
 
 func NewMockExec() *MockExec {
 	return &MockExec{
 		Commands: []MockCommand{},
+		Errors:   map[string]error{},
+		Outputs:  map[string]string{},
+		Delays:   map[string]time.Duration{},
 	}
 }
 
 type MockCommand struct {
 	Dir     string
 	Command string
+	Env     []string
 	Output  string
 	Err     error
 }
 
-func (m MockExec) GoCommand(dir string, args ...string) error {
-	cmd := strings.Join(args, " ")
+func (m *MockExec) record(dir, command string, env []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.Errors[dir]
 	m.Commands = append(m.Commands, MockCommand{
 		Dir:     dir,
-		Command: "go " + cmd,
+		Command: command,
+		Env:     env,
+		Err:     err,
 	})
-	return nil
+	return err
 }
 
-func (m MockExec) BashCommand(absolutePath, script string) error {
-	m.Commands = append(m.Commands, MockCommand{
-		Dir:     absolutePath,
-		Command: script,
-	})
-	return nil
+func (m *MockExec) GoCommand(ctx context.Context, dir string, opts ExecOptions, args ...string) (ExecResult, error) {
+	return m.run(ctx, dir, "go "+strings.Join(args, " "), opts)
+}
+
+func (m *MockExec) BashCommand(ctx context.Context, absolutePath, script string, opts ExecOptions) (ExecResult, error) {
+	return m.run(ctx, absolutePath, script, opts)
 }
 
-func (m MockExec) Output() []MockCommand {
+func (m *MockExec) Command(ctx context.Context, absolutePath string, argv []string, opts ExecOptions) (ExecResult, error) {
+	return m.run(ctx, absolutePath, strings.Join(argv, " "), opts)
+}
+
+// run records a command and streams its output to the writers of the options
+func (m *MockExec) run(ctx context.Context, dir, command string, opts ExecOptions) (ExecResult, error) {
+	err := m.record(dir, command, opts.Env)
+	m.mu.Lock()
+	output := m.Outputs[command]
+	delay := m.Delays[dir]
+	m.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ExecResult{ExitCode: -1}, ctx.Err()
+		}
+	}
+	if output != "" && opts.Stdout != nil {
+		_, _ = io.WriteString(opts.Stdout, output)
+	}
+	return ExecResult{ExitCode: exitCode(err), Stdout: output}, err
+}
+
+func (m *MockExec) GitCommand(ctx context.Context, absolutePath string, args ...string) (string, error) {
+	command := "git " + strings.Join(args, " ")
+	if err := m.record(absolutePath, command, nil); err != nil {
+		return "", err
+	}
+	return m.Outputs[command], nil
+}
+
+func (m *MockExec) Output() []MockCommand {
 	return m.Commands
 }
 
 /////////////////////////////////////////////////////////////////
 
 type MockLogger struct {
+	mu       sync.Mutex
 	Messages []string
 }
 
+func (l *MockLogger) append(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Messages = append(l.Messages, msg)
+}
+
 func NewMockLogger() *MockLogger {
 	return &MockLogger{
 		Messages: []string{},
@@ -242,31 +378,31 @@ func NewMockLogger() *MockLogger {
 }
 
 func (l *MockLogger) FatalLn(msg string) {
-	l.Messages = append(l.Messages, "FATAL: "+msg)
+	l.append("FATAL: " + msg)
 }
 
 func (l *MockLogger) WarningLn(msg string) {
-	l.Messages = append(l.Messages, "WARNING: "+msg)
+	l.append("WARNING: " + msg)
 }
 
 func (l *MockLogger) VerboseLn(msg string) {
-	l.Messages = append(l.Messages, "VERBOSE: "+msg)
+	l.append("VERBOSE: " + msg)
 }
 
 func (l *MockLogger) SuccessLn(msg string) {
-	l.Messages = append(l.Messages, "SUCCESS: "+msg)
+	l.append("SUCCESS: " + msg)
 }
 
 func (l *MockLogger) InfoLn(msg string) {
-	l.Messages = append(l.Messages, "INFO: "+msg)
+	l.append("INFO: " + msg)
 }
 
 func (l *MockLogger) DefaultLn(msg string) {
-	l.Messages = append(l.Messages, "DEFAULT: "+msg)
+	l.append("DEFAULT: " + msg)
 }
 
 func (l *MockLogger) Default(msg string) {
-	l.Messages = append(l.Messages, "DEFAULT: "+msg)
+	l.append("DEFAULT: " + msg)
 }
 
 func (l *MockLogger) Output() []string {
@@ -277,6 +413,7 @@ func (l *MockLogger) Output() []string {
 
 type MockOs struct {
 	Wd                     string
+	Env                    map[string]string
 	QuestionsAnswersBool   map[string]bool
 	QuestionsAnswersString map[string]string
 }
@@ -293,6 +430,15 @@ func (m *MockOs) GetWd() (string, error) {
 	return m.Wd, nil
 }
 
+func (m *MockOs) Getenv(key string) string {
+	return m.Env[key]
+}
+
+func (m *MockOs) LookupEnv(key string) (string, bool) {
+	value, ok := m.Env[key]
+	return value, ok
+}
+
 func (m *MockOs) AskBool(question, choices, defaultValue string, logger LlogI) (response bool, err error) {
 	if answer, exists := m.QuestionsAnswersBool[question]; exists {
 		return answer, nil